@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// EnvSocket is the env variable holding the socket of the running agent
+const EnvSocket = "AVH_AGENT_SOCK"
+
+// operations of the protocol
+const (
+	opGet    = "get"
+	opAdd    = "add"
+	opList   = "list"
+	opRemove = "remove"
+	opLock   = "lock"
+	opUnlock = "unlock"
+	opStop   = "stop"
+)
+
+const dialTimeout = 2 * time.Second
+
+var (
+	// ErrNotFound is returned when the agent holds no password for a vault-id
+	ErrNotFound = errors.New("vault-id not found in agent")
+
+	// ErrLocked is returned when the agent is locked
+	ErrLocked = errors.New("agent is locked")
+
+	// ErrBadPassphrase is returned when the passphrase doesn't unlock the agent
+	ErrBadPassphrase = errors.New("bad agent passphrase")
+)
+
+// Entry describes a password held by the agent, expires is nil for a password kept until removed
+type Entry struct {
+	ID      string     `json:"id"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// request is sent as a json line to the agent, one request per connection
+type request struct {
+	Op         string `json:"op"`
+	ID         string `json:"id,omitempty"`
+	Password   string `json:"password,omitempty"`
+	TTL        int64  `json:"ttl,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+type response struct {
+	Error    string   `json:"error,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Entries  []*Entry `json:"entries,omitempty"`
+}
+
+// protocol errors are sent as text and mapped back to the package errors
+var knownErrors = []error{ErrNotFound, ErrLocked, ErrBadPassphrase}
+
+func toError(message string) error {
+	for _, err := range knownErrors {
+		if err.Error() == message {
+			return err
+		}
+	}
+	return errors.New(message)
+}
+
+// Client talks to the agent listening on a unix socket
+type Client struct {
+	socket string
+}
+
+// NewClient returns a client of the agent listening on socket
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// FromEnv returns a client of the agent given by AVH_AGENT_SOCK, nil if it is not set
+func FromEnv() *Client {
+	if socket := os.Getenv(EnvSocket); socket != "" {
+		return NewClient(socket)
+	}
+	return nil
+}
+
+func (c *Client) call(req *request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.socket, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s : %w", c.socket, err)
+	}
+	defer conn.Close()
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("agent %s : %w", c.socket, err)
+	}
+
+	resp := &response{}
+	if err = json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("agent %s : %w", c.socket, err)
+	}
+
+	if resp.Error != "" {
+		return nil, toError(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// Get returns the password of the vault-id
+func (c *Client) Get(id string) (string, error) {
+	resp, err := c.call(&request{Op: opGet, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return resp.Password, nil
+}
+
+// Add stores the password of the vault-id, a zero ttl uses the default one of the agent
+func (c *Client) Add(id string, password string, ttl time.Duration) error {
+	_, err := c.call(&request{Op: opAdd, ID: id, Password: password, TTL: int64(ttl / time.Second)})
+	return err
+}
+
+// List returns the vault-ids held by the agent
+func (c *Client) List() ([]*Entry, error) {
+	resp, err := c.call(&request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// Remove removes the password of the vault-id, every password if id is empty
+func (c *Client) Remove(id string) error {
+	_, err := c.call(&request{Op: opRemove, ID: id})
+	return err
+}
+
+// Lock locks the agent with a passphrase, passwords are not served until it is unlocked
+func (c *Client) Lock(passphrase string) error {
+	_, err := c.call(&request{Op: opLock, Passphrase: passphrase})
+	return err
+}
+
+// Unlock unlocks the agent
+func (c *Client) Unlock(passphrase string) error {
+	_, err := c.call(&request{Op: opUnlock, Passphrase: passphrase})
+	return err
+}
+
+// Stop wipes the passwords and stops the agent
+func (c *Client) Stop() error {
+	_, err := c.call(&request{Op: opStop})
+	return err
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package agent
+
+import "syscall"
+
+// lockedBuffer holds a secret in memory locked out of swap when the limits of the user allow it
+type lockedBuffer struct {
+	mem    []byte
+	size   int
+	mapped bool
+}
+
+func newLockedBuffer(data []byte) *lockedBuffer {
+	pageSize := syscall.Getpagesize()
+	length := (len(data)/pageSize + 1) * pageSize
+
+	b := &lockedBuffer{size: len(data)}
+
+	mem, err := syscall.Mmap(-1, 0, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		mem = make([]byte, len(data))
+	} else {
+		b.mapped = true
+		// without the right to lock memory the secret is still kept out of the go heap
+		syscall.Mlock(mem)
+	}
+
+	copy(mem, data)
+	b.mem = mem
+	return b
+}
+
+func (b *lockedBuffer) String() string {
+	return string(b.mem[:b.size])
+}
+
+// wipe overwrites the secret and releases its memory
+func (b *lockedBuffer) wipe() {
+	for i := range b.mem {
+		b.mem[i] = 0
+	}
+	if b.mapped {
+		syscall.Munlock(b.mem)
+		syscall.Munmap(b.mem)
+	}
+	b.mem = nil
+	b.size = 0
+}
@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package agent
+
+// lockedBuffer holds a secret, memory can't be locked on this platform
+type lockedBuffer struct {
+	mem []byte
+}
+
+func newLockedBuffer(data []byte) *lockedBuffer {
+	return &lockedBuffer{mem: append([]byte{}, data...)}
+}
+
+func (b *lockedBuffer) String() string {
+	return string(b.mem)
+}
+
+// wipe overwrites the secret
+func (b *lockedBuffer) wipe() {
+	for i := range b.mem {
+		b.mem[i] = 0
+	}
+	b.mem = nil
+}
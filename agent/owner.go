@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser tells if the file belongs to the user running the agent
+func ownedByUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package agent
+
+import "os"
+
+// ownedByUser can't check the owner on this platform, the socket directory of the user is trusted
+func ownedByUser(info os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	socketMode     = 0600
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	// ErrRunning is returned when an agent already listens on the socket
+	ErrRunning = errors.New("an agent is already running")
+	// ErrNotSocket is returned when the socket path is used by another file
+	ErrNotSocket = errors.New("not a socket of the user, remove it or choose another socket")
+
+	errNotLocked   = errors.New("agent is not locked")
+	errUnknownOp   = errors.New("unknown agent operation")
+	errEmptyValue  = errors.New("vault-id and password can't be empty")
+	errEmptyPhrase = errors.New("passphrase can't be empty")
+)
+
+// entry is a password held by the agent, the timer removes it when its ttl expires
+type entry struct {
+	secret  *lockedBuffer
+	expires time.Time
+	timer   *time.Timer
+}
+
+// Server holds vault-id passwords in locked memory and serves them over a unix socket
+type Server struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	entries  map[string]*entry
+	lockSalt []byte
+	lockHash []byte
+	listener net.Listener
+}
+
+// NewServer returns an agent keeping passwords for ttl by default, forever if ttl is zero
+func NewServer(ttl time.Duration) *Server {
+	return &Server{ttl: ttl, entries: map[string]*entry{}}
+}
+
+// Listen creates the unix socket of the agent, only the user can connect to it
+// a socket of the user left by an agent that is not running anymore is replaced
+func Listen(socket string) (net.Listener, error) {
+	if info, err := os.Lstat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 || !ownedByUser(info) {
+			return nil, fmt.Errorf("%s : %w", socket, ErrNotSocket)
+		}
+		if conn, err := net.DialTimeout("unix", socket, dialTimeout); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s : %w", socket, ErrRunning)
+		}
+		if err = os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chmod(socket, socketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// Serve answers requests until the agent is stopped, passwords are wiped when it returns
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	defer s.wipe()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			stopped := s.listener == nil
+			s.mu.Unlock()
+			if stopped {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Stop closes the socket, Serve returns once it is closed
+func (s *Server) Stop() {
+	s.mu.Lock()
+	listener := s.listener
+	s.listener = nil
+	s.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	req := &request{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		return
+	}
+
+	resp, err := s.process(req)
+	if err != nil {
+		resp = &response{Error: err.Error()}
+	}
+	json.NewEncoder(conn).Encode(resp)
+
+	if req.Op == opStop && err == nil {
+		s.Stop()
+	}
+}
+
+func (s *Server) process(req *request) (*response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Op {
+	case opStop:
+		return &response{}, nil
+	case opUnlock:
+		return &response{}, s.unlock(req.Passphrase)
+	}
+
+	// a locked agent only accepts to be unlocked or stopped
+	if s.lockHash != nil {
+		return nil, ErrLocked
+	}
+
+	switch req.Op {
+	case opGet:
+		e, ok := s.entries[req.ID]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return &response{Password: e.secret.String()}, nil
+	case opAdd:
+		return &response{}, s.add(req.ID, req.Password, time.Duration(req.TTL)*time.Second)
+	case opList:
+		entries := []*Entry{}
+		for id, e := range s.entries {
+			entry := &Entry{ID: id}
+			if !e.expires.IsZero() {
+				expires := e.expires
+				entry.Expires = &expires
+			}
+			entries = append(entries, entry)
+		}
+		return &response{Entries: entries}, nil
+	case opRemove:
+		if req.ID == "" {
+			for id := range s.entries {
+				s.remove(id)
+			}
+			return &response{}, nil
+		}
+		if _, ok := s.entries[req.ID]; !ok {
+			return nil, ErrNotFound
+		}
+		s.remove(req.ID)
+		return &response{}, nil
+	case opLock:
+		return &response{}, s.lock(req.Passphrase)
+	}
+
+	return nil, fmt.Errorf("%s : %w", req.Op, errUnknownOp)
+}
+
+// add stores a password, it replaces the one of the vault-id if any
+func (s *Server) add(id string, password string, ttl time.Duration) error {
+	if id == "" || password == "" {
+		return errEmptyValue
+	}
+
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+
+	s.remove(id)
+
+	e := &entry{secret: newLockedBuffer([]byte(password))}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+		e.timer = time.AfterFunc(ttl, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			// the password may have been replaced since
+			if s.entries[id] == e {
+				s.remove(id)
+			}
+		})
+	}
+	s.entries[id] = e
+
+	return nil
+}
+
+// remove wipes the password of the vault-id, the lock must be held
+func (s *Server) remove(id string) {
+	e, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.secret.wipe()
+	delete(s.entries, id)
+}
+
+func (s *Server) wipe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.entries {
+		s.remove(id)
+	}
+}
+
+func hashPassphrase(salt []byte, passphrase string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), passphrase...))
+	return sum[:]
+}
+
+func (s *Server) lock(passphrase string) error {
+	if passphrase == "" {
+		return errEmptyPhrase
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	s.lockSalt = salt
+	s.lockHash = hashPassphrase(salt, passphrase)
+	return nil
+}
+
+func (s *Server) unlock(passphrase string) error {
+	if s.lockHash == nil {
+		return errNotLocked
+	}
+
+	if subtle.ConstantTimeCompare(hashPassphrase(s.lockSalt, passphrase), s.lockHash) != 1 {
+		return ErrBadPassphrase
+	}
+
+	s.lockSalt, s.lockHash = nil, nil
+	return nil
+}
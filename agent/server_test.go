@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-agent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	// a stale socket is replaced
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("stale socket : %v", err)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != socketMode {
+		t.Errorf("socket mode : got %v, %v", info, err)
+	}
+
+	// a running agent is kept
+	if _, err = Listen(socket); !errors.Is(err, ErrRunning) {
+		t.Errorf("running agent : got %v, want %v", err, ErrRunning)
+	}
+	listener.Close()
+
+	// other files are never removed
+	file := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(file, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(file, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{file, link, dir} {
+		if _, err = Listen(path); !errors.Is(err, ErrNotSocket) {
+			t.Errorf("%s : got %v, want %v", path, err, ErrNotSocket)
+		}
+		if _, err = os.Lstat(path); err != nil {
+			t.Errorf("%s : %v", path, err)
+		}
+	}
+}
@@ -29,7 +29,8 @@ func Trap(fn trapFn) trapFn {
 		defer func() {
 			wg.Wait()
 			if c != nil {
-				os.Exit(1)
+				// interrupted by the user, 128 + SIGINT as shells do
+				os.Exit(130)
 			}
 		}()
 
@@ -0,0 +1,391 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pleclech/ansible-vault-helper/agent"
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	agentDirPrefix  = "avh-agent-"
+	agentSocketName = "agent.sock"
+	agentStartWait  = 5 * time.Second
+)
+
+var (
+	agentSocket     string
+	agentTTL        time.Duration
+	agentAddTTL     time.Duration
+	agentForeground bool
+	agentRemoveAll  bool
+)
+
+// ErrNoAgent is returned when AVH_AGENT_SOCK is not set
+var ErrNoAgent = errors.New(agent.EnvSocket + " is not set, start an agent with eval $(avh agent)")
+
+// agentResult is the agent part of the json report
+type agentResult struct {
+	Socket string         `json:"socket,omitempty"`
+	PID    int            `json:"pid,omitempty"`
+	Keys   []*agent.Entry `json:"keys,omitempty"`
+}
+
+func agentClient() (*agent.Client, error) {
+	client := agent.FromEnv()
+	if client == nil {
+		return nil, ErrNoAgent
+	}
+	return client, nil
+}
+
+// agentID returns the id of a label@source vault-id in the agent, the source doesn't have to exist
+func agentID(vaultID string) string {
+	label, source := vault.DefaultLabel, vaultID
+	if idx := strings.Index(vaultID, "@"); idx >= 0 {
+		label, source = vaultID[:idx], vaultID[idx+1:]
+	}
+	k := vault.Key{Label: label, Value: source, IsFile: true}
+	if source == "prompt" || source == "prompt_ask_vault_pass" || vault.IsStoreSource(source) {
+		k, _ = vault.ParseVaultID(vaultID)
+	}
+	return k.AgentID()
+}
+
+// newAgentSocket returns a socket in a new private directory, below $XDG_RUNTIME_DIR if set
+func newAgentSocket() (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		base = os.TempDir()
+	}
+
+	dir, err := ioutil.TempDir(base, agentDirPrefix)
+	if err != nil {
+		return "", err
+	}
+	if err = os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return filepath.Join(dir, agentSocketName), nil
+}
+
+// runAgent serves the keys until the agent is stopped or receives SIGINT or SIGTERM
+func runAgent(socket string) error {
+	listener, err := agent.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		os.Remove(socket)
+		// the private directory created for the socket
+		if dir := filepath.Dir(socket); strings.HasPrefix(filepath.Base(dir), agentDirPrefix) {
+			os.Remove(dir)
+		}
+	}()
+
+	server := agent.NewServer(agentTTL)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Stop()
+	}()
+
+	return server.Serve(listener)
+}
+
+// startAgent runs the agent in the background and prints the shell commands setting AVH_AGENT_SOCK
+func startAgent(socket string) error {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s : %w", socket, agent.ErrRunning)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	child := exec.Command(exe, "agent", "--foreground", "--socket", socket, "--ttl", agentTTL.String())
+	detach(child)
+	if err = child.Start(); err != nil {
+		return fmt.Errorf("agent : %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- child.Wait()
+	}()
+
+	for deadline := time.Now().Add(agentStartWait); ; {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err = <-exited:
+			return fmt.Errorf("agent exited : %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			child.Process.Kill()
+			return fmt.Errorf("agent : %s not ready", socket)
+		}
+	}
+
+	if jsonOutput() {
+		results.Agent = &agentResult{Socket: socket, PID: child.Process.Pid}
+		return nil
+	}
+
+	fmt.Printf("%s=%s; export %s;\n", agent.EnvSocket, socket, agent.EnvSocket)
+	fmt.Printf("echo Agent pid %d;\n", child.Process.Pid)
+	return nil
+}
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start an agent caching vault keys",
+	Long: `Start an agent holding vault-id keys in locked memory and serving them over a unix socket only the user can use,
+	as ssh-agent it runs in the background and prints the commands setting AVH_AGENT_SOCK, use it with eval $(avh agent)
+	keys are looked up in the agent before reading a key file, running a key executable or asking for a key
+	keys given by an executable are added to the agent, keys expire after --ttl
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		socket := agentSocket
+		if socket == "" {
+			var err error
+			if socket, err = newAgentSocket(); err != nil {
+				return err
+			}
+		}
+
+		if agentForeground {
+			return runAgent(socket)
+		}
+		return startAgent(socket)
+	},
+}
+
+// agentAddCmd represents the agent add command
+var agentAddCmd = &cobra.Command{
+	Use:   "add [vault-id...]",
+	Short: "Add keys to the agent",
+	Long: `Add label@source vault-ids to the agent, by default the vault-ids given by the flags or the config,
+	the default key is asked for when there is none
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+
+		keys := []vault.Key{}
+		for _, vaultID := range args {
+			key, err := vault.ParseVaultID(vaultID)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+
+		if len(args) == 0 {
+			flagKeys, err := GetKeysFromFlags()
+			if err != nil {
+				return err
+			}
+			for _, key := range flagKeys {
+				if key.AgentID() != "" {
+					keys = append(keys, key)
+				}
+			}
+		}
+
+		if len(keys) == 0 {
+			keys = append(keys, vault.Key{Label: vault.DefaultLabel, IsPrompt: true})
+		}
+
+		for _, key := range keys {
+			var password string
+			switch {
+			case key.IsPrompt:
+				password, err = readPassword(fmt.Sprintf("Enter key for vault-id %s", key.AgentID()), keyPrompt)
+			case key.IsKeyring, key.IsPass:
+				password, err = vault.GetKey(key, envKeyPrefix)
+			default:
+				// the key is read from its source, not from the agent, and kept as read whatever --key-raw is
+				password, err = vault.GetRawKeyFromFileWithLabel(key.Value, key.IsExec, key.Label)
+			}
+			if err != nil {
+				return err
+			}
+
+			if err = client.Add(key.AgentID(), password, agentAddTTL); err != nil {
+				return err
+			}
+			if !jsonOutput() {
+				fmt.Printf("added %s\n", key.AgentID())
+			}
+		}
+
+		return nil
+	},
+}
+
+// agentListCmd represents the agent list command
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the vault-ids held by the agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+
+		entries, err := client.List()
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+		if jsonOutput() {
+			results.Agent = &agentResult{Socket: os.Getenv(agent.EnvSocket), Keys: entries}
+			return nil
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("the agent holds no key")
+		}
+		for _, e := range entries {
+			if e.Expires == nil {
+				fmt.Printf("%s\n", e.ID)
+				continue
+			}
+			fmt.Printf("%s (expires in %s)\n", e.ID, time.Until(*e.Expires).Round(time.Second))
+		}
+
+		return nil
+	},
+}
+
+// agentRemoveCmd represents the agent remove command
+var agentRemoveCmd = &cobra.Command{
+	Use:   "remove [vault-id...]",
+	Short: "Remove keys from the agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+
+		if agentRemoveAll {
+			return client.Remove("")
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("agent remove : give the vault-ids to remove or --all")
+		}
+
+		for _, vaultID := range args {
+			id := agentID(vaultID)
+			if err = client.Remove(id); err != nil {
+				return fmt.Errorf("%s : %w", id, err)
+			}
+		}
+
+		return nil
+	},
+}
+
+// agentLockCmd represents the agent lock command
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the agent with a passphrase, keys are not served until it is unlocked",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := readPassword("Enter lock passphrase", "")
+		if err != nil {
+			return err
+		}
+		confirm, err := readPassword("Confirm lock passphrase", "")
+		if err != nil {
+			return err
+		}
+		if passphrase != confirm {
+			return fmt.Errorf("error passphrase differs")
+		}
+
+		return client.Lock(passphrase)
+	},
+}
+
+// agentUnlockCmd represents the agent unlock command
+var agentUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := readPassword("Enter lock passphrase", "")
+		if err != nil {
+			return err
+		}
+
+		return client.Unlock(passphrase)
+	},
+}
+
+// agentStopCmd represents the agent stop command
+var agentStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Wipe the keys and stop the agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := agentClient()
+		if err != nil {
+			return err
+		}
+		return client.Stop()
+	},
+}
+
+func init() {
+	f := agentCmd.Flags()
+	f.StringVar(&agentSocket, "socket", "", "unix socket of the agent, a new one in a private directory by default")
+	f.DurationVar(&agentTTL, "ttl", time.Hour, "time keys are kept, 0 keeps them until removed")
+	f.BoolVarP(&agentForeground, "foreground", "f", false, "run in the foreground, for service managers")
+
+	agentAddCmd.Flags().DurationVar(&agentAddTTL, "ttl", 0, "time the keys are kept, the one of the agent by default")
+	agentRemoveCmd.Flags().BoolVar(&agentRemoveAll, "all", false, "remove every key")
+
+	agentCmd.AddCommand(agentAddCmd, agentListCmd, agentRemoveCmd, agentLockCmd, agentUnlockCmd, agentStopCmd)
+	rootCmd.AddCommand(agentCmd)
+}
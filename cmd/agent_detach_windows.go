@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach runs the command in a new process group so it outlives the console
+func detach(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
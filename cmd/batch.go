@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	includePatterns, excludePatterns []string
+	noIgnore                         bool
+	jobs                             int
+)
+
+// addBatchFlags adds the flags selecting and processing several files
+func addBatchFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringArrayVar(&includePatterns, "include", nil, "only process files matching the pattern, can be repeated")
+	f.StringArrayVar(&excludePatterns, "exclude", nil, "skip files and directories matching the pattern, can be repeated")
+	f.BoolVar(&noIgnore, "no-ignore", false, "process files ignored by .gitignore too")
+	f.IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "number of files processed concurrently")
+}
+
+func hasGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// batchMode returns true if the arguments are more than one file, a directory or a glob
+func batchMode(args []string) bool {
+	if len(args) != 1 {
+		return len(args) > 1
+	}
+	if hasGlob(args[0]) {
+		return true
+	}
+	stat, err := os.Stat(args[0])
+	return err == nil && stat.IsDir()
+}
+
+// splitGlob splits a glob into the directory to walk and the pattern matched below it
+func splitGlob(name string) (string, string) {
+	segments := strings.Split(filepath.ToSlash(name), "/")
+	for i, segment := range segments {
+		if !hasGlob(segment) {
+			continue
+		}
+		root := strings.Join(segments[:i], "/")
+		switch {
+		case i == 1 && segments[0] == "":
+			root = "/"
+		case root == "":
+			root = "."
+		}
+		return filepath.FromSlash(root), strings.Join(segments[i:], "/")
+	}
+	return name, ""
+}
+
+func selected(rel string) bool {
+	if len(includePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range includePatterns {
+		if matchName(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func excluded(rel string) bool {
+	for _, pattern := range excludePatterns {
+		if matchName(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileWalker lists the files given as arguments once
+type fileWalker struct {
+	files []string
+	seen  map[string]bool
+}
+
+// listFiles expands directories and globs into the files they contain
+// hidden files and directories, files ignored by git and files not selected by --include and --exclude are skipped,
+// files given explicitly are always listed
+func listFiles(paths []string) ([]string, error) {
+	w := &fileWalker{files: []string{}, seen: map[string]bool{}}
+
+	for _, name := range paths {
+		root, pattern := splitGlob(name)
+
+		stat, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+
+		if !stat.IsDir() {
+			w.addFile(root)
+			continue
+		}
+
+		count := len(w.files)
+		if err = w.walk(root, pattern); err != nil {
+			return nil, err
+		}
+		if pattern != "" && count == len(w.files) {
+			return nil, fmt.Errorf("%s : %w", name, os.ErrNotExist)
+		}
+	}
+
+	return w.files, nil
+}
+
+func (w *fileWalker) addFile(fileName string) {
+	if !w.seen[fileName] {
+		w.seen[fileName] = true
+		w.files = append(w.files, fileName)
+	}
+}
+
+// walk lists the files of root matching the pattern, every file if the pattern is empty
+func (w *fileWalker) walk(root string, pattern string) error {
+	rules := []ignoreRule{}
+	if !noIgnore {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		rules = parentIgnoreRules(abs)
+	}
+	return w.walkDir(root, "", rules, pattern)
+}
+
+func (w *fileWalker) walkDir(dir string, rel string, rules []ignoreRule, pattern string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !noIgnore {
+		// rules of a directory don't apply to its siblings
+		rules = append(rules[:len(rules):len(rules)], readIgnoreRules(abs)...)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		relName := path.Join(rel, name)
+		if strings.HasPrefix(name, ".") || ignored(rules, filepath.Join(abs, name), info.IsDir()) || excluded(relName) {
+			continue
+		}
+
+		if info.IsDir() {
+			// every file of a directory matching the glob is listed
+			subPattern := pattern
+			if pattern != "" && matchPath(pattern, relName) {
+				subPattern = ""
+			}
+			if err = w.walkDir(filepath.Join(dir, name), relName, rules, subPattern); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() || (pattern != "" && !matchPath(pattern, relName)) || !selected(relName) {
+			continue
+		}
+		w.addFile(filepath.Join(dir, name))
+	}
+
+	return nil
+}
+
+// batchIdentities returns the identities given on the cli, the key is asked for once when there is none
+// as files are processed concurrently no key is asked for later
+func batchIdentities(newKey bool) (vault.Identities, error) {
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(identities) > 0 || doNotAskForKey {
+		return identities, nil
+	}
+
+	var key string
+	if newKey {
+		key, err = readNewPassword(keyPrompt)
+	} else {
+		key, err = readPassword("Enter key", keyPrompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(identities, vault.Identity{Label: vault.DefaultLabel, Password: key}), nil
+}
+
+// batchOutput returns the file to write, the file itself or the same path below the --output directory
+func batchOutput(fileName string) string {
+	if output == "" {
+		return fileName
+	}
+
+	rel := filepath.Clean(fileName)
+	if filepath.IsAbs(rel) {
+		rel = strings.TrimLeft(rel[len(filepath.VolumeName(rel)):], string(filepath.Separator))
+	}
+	for strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = rel[3:]
+	}
+
+	return filepath.Join(output, rel)
+}
+
+// batchOutputs returns the output of every file, it fails when files would be written to the same output,
+// as ../a/x.yml and a/x.yml below the --output directory
+func batchOutputs(files []string) (map[string]string, error) {
+	outputs := map[string]string{}
+	owners := map[string]string{}
+	for _, fileName := range files {
+		outName := batchOutput(fileName)
+		abs, err := filepath.Abs(outName)
+		if err != nil {
+			return nil, err
+		}
+		if previous, ok := owners[abs]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", previous, fileName, outName)
+		}
+		owners[abs] = fileName
+		outputs[fileName] = outName
+	}
+	return outputs, nil
+}
+
+func writeBatchOutput(fileName string, content []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	return writeToFile(fileName, content, mode)
+}
+
+// decryptPath decrypts the vaults of the file into outName, files without vault are skipped
+func decryptPath(result *fileResult, identities vault.Identities, outName string) error {
+	inputInfo, err := GetInputInfo(result.File, identities, "")
+	if err != nil {
+		return err
+	}
+
+	if !inputInfo.HasVault() {
+		result.Status = statusSkipped
+		return nil
+	}
+
+	result.describe(inputInfo.content, inputInfo.IsYaml())
+
+	if err = inputInfo.Decrypt(true, keyPrompt); err != nil {
+		return err
+	}
+
+	result.Status = statusDecrypted
+	result.Output = outName
+	if err = writeBatchOutput(outName, inputInfo.content, inputInfo.fileMode); err != nil {
+		return fmt.Errorf("saving decrypted file : %w", err)
+	}
+
+	return nil
+}
+
+// encryptPath encrypts the file into outName, a file encrypted in place is left untouched when unchanged
+func encryptPath(result *fileResult, identities vault.Identities, outName string) error {
+	inputInfo, err := GetInputInfo(result.File, identities, encryptVaultID)
+	if err != nil {
+		return err
+	}
+
+	if err = inputInfo.Decrypt(true, keyPrompt); err != nil {
+		return err
+	}
+
+	encString, err := inputInfo.Encrypt()
+	if err != nil {
+		return fmt.Errorf("encrypt : %w", err)
+	}
+
+	result.describe(encString, inputInfo.IsYaml())
+	result.Status = statusEncrypted
+	if bytes.Equal(encString, inputInfo.original) {
+		result.Status = statusUnchanged
+		if outName == result.File {
+			return nil
+		}
+	}
+
+	result.Output = outName
+	if err = writeBatchOutput(outName, encString, inputInfo.fileMode); err != nil {
+		return fmt.Errorf("saving encrypted file : %w", err)
+	}
+
+	return nil
+}
+
+// runBatch runs fn on every file with --jobs workers, results are printed in the order of the files
+// followed by a summary
+func runBatch(name string, files []string, fn func(result *fileResult) error) error {
+	batch := make([]*fileResult, len(files))
+	errs := make([]error, len(files))
+	done := make([]chan struct{}, len(files))
+	for i, fileName := range files {
+		batch[i] = newFileResult(fileName)
+		done[i] = make(chan struct{})
+	}
+
+	workers := jobs
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan int)
+	for j := 0; j < workers; j++ {
+		go func() {
+			for i := range queue {
+				if errs[i] = fn(batch[i]); errs[i] != nil {
+					batch[i].fail(errs[i])
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	results.Summary = map[string]int{}
+	failed := 0
+	var firstErr error
+	for i, result := range batch {
+		<-done[i]
+		results.Summary[result.Status]++
+		if errs[i] != nil {
+			if failed == 0 {
+				firstErr = errs[i]
+			}
+			failed++
+		}
+		if !jsonOutput() {
+			printResult(result)
+		}
+	}
+
+	if !jsonOutput() {
+		printSummary(len(files), results.Summary)
+	}
+
+	if failed > 0 {
+		// the exit code is the one of the first failure
+		return fmt.Errorf("%s : %d file(s) failed, first : %w", name, failed, firstErr)
+	}
+
+	return nil
+}
+
+func printResult(result *fileResult) {
+	switch result.Status {
+	case statusOK, statusSkipped:
+	case statusProblem:
+		for _, p := range result.Problems {
+			if p.Path != "" {
+				fmt.Printf("%s:%d: %s : %s\n", result.File, p.Line, p.Path, p.Message)
+			} else {
+				fmt.Printf("%s:%d: %s\n", result.File, p.Line, p.Message)
+			}
+		}
+	case statusError:
+		fmt.Printf("%-9s %s : %s\n", "failed", result.File, result.Error.Message)
+	default:
+		fmt.Printf("%-9s %s\n", result.Status, result.File)
+	}
+}
+
+func printSummary(count int, summary map[string]int) {
+	counts := []string{}
+	for _, status := range []string{statusOK, statusDecrypted, statusEncrypted, statusRekeyed, statusUnchanged, statusSkipped, statusProblem, statusError} {
+		if summary[status] == 0 {
+			continue
+		}
+		label := status
+		switch status {
+		case statusProblem:
+			label = "with problems"
+		case statusError:
+			label = "failed"
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", summary[status], label))
+	}
+	fmt.Printf("%d file(s)", count)
+	if len(counts) > 0 {
+		fmt.Printf(" : %s", strings.Join(counts, ", "))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBatchOutput(t *testing.T) {
+	defer func(out string) { output = out }(output)
+
+	output = ""
+	if got := batchOutput("a/x.yml"); got != "a/x.yml" {
+		t.Errorf("in place : got %q", got)
+	}
+
+	output = "out"
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "a/x.yml", want: "out/a/x.yml"},
+		{file: "./a/x.yml", want: "out/a/x.yml"},
+		{file: "../a/x.yml", want: "out/a/x.yml"},
+		{file: "../../b/y.yml", want: "out/b/y.yml"},
+		{file: "/etc/z.yml", want: "out/etc/z.yml"},
+	}
+	for _, tt := range tests {
+		if got := batchOutput(filepath.FromSlash(tt.file)); got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s : got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBatchOutputsCollision(t *testing.T) {
+	defer func(out string) { output = out }(output)
+	output = "out"
+
+	outputs, err := batchOutputs([]string{"a/x.yml", "a/y.yml", "b/x.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outputs["b/x.yml"]; got != filepath.Join("out", "b", "x.yml") {
+		t.Errorf("got %q", got)
+	}
+
+	for _, files := range [][]string{
+		{"../a/x.yml", "a/x.yml"},
+		{"a/x.yml", "./a/x.yml"},
+		{"/a/x.yml", "a/x.yml"},
+	} {
+		if _, err = batchOutputs(files); err == nil {
+			t.Errorf("%q : no collision reported", files)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	checkVaultPatterns, checkSecretKeys, checkSecretTags []string
+	checkDecrypt                                         bool
+
+	defaultSecretKeys = []string{"*password*", "*passwd*", "*secret*", "*token*", "*_key"}
+	// booleans and numbers, as use_token: true or token_ttl: 3600, are not secrets
+	defaultSecretTags = []string{"!!str"}
+)
+
+// status of a checked file
+const statusProblem = "problem"
+
+// problem is an issue found by check, path is the key path of yaml entries
+type problem struct {
+	Line    int    `json:"line"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// matchAnywhere matches a pattern against the end of a slash separated name, or the whole name if it starts with /
+func matchAnywhere(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		return matchPath(pattern[1:], name)
+	}
+	return matchPath("**/"+pattern, name)
+}
+
+func isVaultFile(fileName string) bool {
+	name := filepath.ToSlash(filepath.Clean(fileName))
+	for _, pattern := range checkVaultPatterns {
+		if matchAnywhere(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range checkSecretKeys {
+		if matchPath(strings.ToLower(pattern), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// findPlainSecrets returns the plaintext values of secret keys of every document of the yaml content
+// templated values are skipped as they usually point to a vaulted variable
+func findPlainSecrets(content []byte) ([]*problem, error) {
+	problems := []*problem{}
+
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				childPath := key.Value
+				if path != "" {
+					childPath = path + "." + key.Value
+				}
+				if value.Kind == yaml.ScalarNode && isSecretKey(key.Value) && plainValue(value) {
+					problems = append(problems, &problem{Line: value.Line, Path: childPath, Message: "plaintext value of a secret key"})
+					continue
+				}
+				walk(value, childPath)
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yaml : %w", err)
+		}
+		walk(&doc, "")
+	}
+
+	return problems, nil
+}
+
+// plainValue returns true for a non empty value tagged with a --secret-tag that isn't templated
+func plainValue(node *yaml.Node) bool {
+	if node.Tag == yamlVaultTag || node.Value == "" || strings.Contains(node.Value, "{{") {
+		return false
+	}
+	return containsString(checkSecretTags, node.ShortTag())
+}
+
+// checkFile looks for unencrypted vault files, plaintext secrets and, with --decrypt, vaults that can't be decrypted
+func checkFile(result *fileResult, identities vault.Identities) error {
+	content, err := ioutil.ReadFile(result.File)
+	if err != nil {
+		return err
+	}
+
+	problems := []*problem{}
+	addProblem := func(p *problem) {
+		problems = append(problems, p)
+	}
+
+	inputInfo := &InputInfo{content: content}
+	inputInfo.setFileExt(result.File)
+
+	switch {
+	case vault.MaybeEncryptedBytes(content):
+		result.describe(content, false)
+		if checkDecrypt {
+			if _, _, err = identities.DecryptBytes(content); err != nil {
+				addProblem(&problem{Line: 1, Message: fmt.Sprintf("vault can't be decrypted : %s", err)})
+			}
+		}
+	case isVaultFile(result.File):
+		addProblem(&problem{Line: 1, Message: "vault file is not encrypted"})
+	}
+
+	if inputInfo.IsYaml() && !vault.MaybeEncryptedBytes(content) {
+		// files that aren't valid yaml, as templates, are not checked
+		secrets, err := findPlainSecrets(content)
+		if err == nil {
+			problems = append(problems, secrets...)
+		}
+
+		vaults, err := findYamlVaults(content)
+		if err == nil {
+			result.describe(content, true)
+		}
+		for _, v := range vaults {
+			switch {
+			case !v.IsEncrypted():
+				addProblem(&problem{Line: v.line, Path: v.path, Message: "!vault value is not encrypted"})
+			case checkDecrypt:
+				if _, _, err = identities.Decrypt(v.vaultText()); err != nil {
+					addProblem(&problem{Line: v.line, Path: v.path, Message: fmt.Sprintf("vault can't be decrypted : %s", err)})
+				}
+			}
+		}
+	}
+
+	result.Status = statusOK
+	if len(problems) > 0 {
+		result.Status = statusProblem
+		result.Problems = problems
+	}
+
+	return nil
+}
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check [path...]",
+	Short: "Check that vault files are encrypted and that yaml files hold no plaintext secret",
+	Long: `Check files, directories and globs, the current directory by default, and fail when
+	a file matching --vault-pattern is not a vault
+	a yaml key matching --secret-key holds a plaintext value instead of a !vault one, templated values are allowed
+	a !vault value is not encrypted
+	with --decrypt, a vault can't be decrypted with the given keys
+	every problem is reported as file:line
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths := args
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+
+		files, err := listFiles(paths)
+		if err != nil {
+			return err
+		}
+
+		identities := vault.Identities{}
+		if checkDecrypt {
+			if identities, err = batchIdentities(false); err != nil {
+				return err
+			}
+		}
+
+		if err = runBatch("check", files, func(result *fileResult) error {
+			return checkFile(result, identities)
+		}); err != nil {
+			return err
+		}
+
+		count := 0
+		for _, result := range results.Files {
+			count += len(result.Problems)
+		}
+		if count > 0 {
+			return fmt.Errorf("check : %d problem(s) found", count)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	f := checkCmd.Flags()
+	f.StringArrayVar(&checkVaultPatterns, "vault-pattern", defaultGitPatterns, "pattern of the files that must be vaults, can be repeated")
+	f.StringArrayVar(&checkSecretKeys, "secret-key", defaultSecretKeys, "pattern of the yaml keys that must hold a !vault value, can be repeated")
+	f.StringArrayVar(&checkSecretTags, "secret-tag", defaultSecretTags, "tag of the plaintext values reported for secret keys, as !!str, !!int or !!binary, can be repeated")
+	f.BoolVar(&checkDecrypt, "decrypt", false, "check that every vault can be decrypted with the given keys")
+	addBatchFlags(checkCmd)
+
+	rootCmd.AddCommand(checkCmd)
+}
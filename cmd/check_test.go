@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestFindPlainSecrets(t *testing.T) {
+	defer func(keys, tags []string) { checkSecretKeys, checkSecretTags = keys, tags }(checkSecretKeys, checkSecretTags)
+	checkSecretKeys, checkSecretTags = defaultSecretKeys, defaultSecretTags
+
+	content := `---
+use_token: true
+token_ttl: 3600
+db_password: hunter2
+api_token: "true"
+empty_secret:
+null_secret: ~
+templated_password: "{{ vault_db_password }}"
+vault_password: !vault |
+  $ANSIBLE_VAULT;1.1;AES256
+  6162
+name: admin
+users:
+  - name: bob
+    password: bob123
+`
+
+	problems, err := findPlainSecrets([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line int
+		path string
+	}{
+		{line: 4, path: "db_password"},
+		{line: 5, path: "api_token"},
+		{line: 15, path: "users[0].password"},
+	}
+	if len(problems) != len(want) {
+		for _, p := range problems {
+			t.Logf("%d %s", p.Line, p.Path)
+		}
+		t.Fatalf("got %d problems, want %d", len(problems), len(want))
+	}
+	for i, p := range problems {
+		if p.Line != want[i].line || p.Path != want[i].path {
+			t.Errorf("problem %d : got %d %s, want %d %s", i, p.Line, p.Path, want[i].line, want[i].path)
+		}
+	}
+
+	checkSecretTags = []string{"!!str", "!!int"}
+	if problems, err = findPlainSecrets([]byte(content)); err != nil || len(problems) != 4 {
+		t.Errorf("with !!int : got %d problems, %v, want 4", len(problems), err)
+	}
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/editor"
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigName is the config file looked up from the current directory up to the root
+const projectConfigName = ".avh.yaml"
+
+// settings that are not flags
+const (
+	settingEditor      = "editor"
+	settingYamlIndent  = "yaml-indent"
+	settingDirectories = "directories"
+)
+
+var (
+	// homeConfigNames are the config files looked up in the home directory
+	homeConfigNames = []string{".avh", ".avh.yaml", ".avh.yml"}
+
+	// settings holding a path relative to the directory of the config file
+	pathSettings = []string{"key-file", "key-exec", "new-key-file", "new-key-exec", "key-identity"}
+	// settings holding label@source vault-ids
+	vaultIDSettings = []string{"vault-id", "new-vault-id"}
+	// key settings are all taken from the command line when one of them is given
+	keySettings = []string{"key", "key-file", "key-exec", "vault-id", "encrypt-vault-id"}
+
+	// configEditor is the editor set in the config, it takes precedence over EDITOR
+	configEditor string
+)
+
+// config is a config file, settings are named as the long flags
+// settings of directories apply to the files below them
+type config struct {
+	dir         string
+	settings    map[string]interface{}
+	directories map[string]map[string]interface{}
+}
+
+// readConfig reads a yaml config file
+func readConfig(fileName string) (*config, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return nil, fmt.Errorf("%s : %w", fileName, err)
+	}
+
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &config{
+		dir:         filepath.Dir(abs),
+		settings:    settings,
+		directories: map[string]map[string]interface{}{},
+	}
+
+	if directories, ok := settings[settingDirectories]; ok {
+		delete(settings, settingDirectories)
+		entries, ok := directories.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s : %s must be a map of directories", fileName, settingDirectories)
+		}
+		for dir, entry := range entries {
+			dirSettings, ok := entry.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s : %s %s must be a map of settings", fileName, settingDirectories, dir)
+			}
+			c.directories[c.resolvePath(dir)] = dirSettings
+		}
+	}
+
+	return c, nil
+}
+
+// resolvePath expands ~ and makes a path relative to the directory of the config file absolute
+func (c *config) resolvePath(name string) string {
+	if expanded, err := homedir.Expand(name); err == nil {
+		name = expanded
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(c.dir, name)
+}
+
+// resolveSetting resolves the paths held by a setting
+func (c *config) resolveSetting(name string, value interface{}) interface{} {
+	resolve := func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return v
+		}
+		switch {
+		case containsString(pathSettings, name):
+			return c.resolvePath(s)
+		case containsString(vaultIDSettings, name):
+			idx := strings.Index(s, "@")
+			if idx < 0 {
+				return s
+			}
+			source := s[idx+1:]
+			if source == "prompt" || source == "prompt_ask_vault_pass" || vault.IsStoreSource(source) {
+				return s
+			}
+			return s[:idx+1] + c.resolvePath(source)
+		}
+		return v
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		resolved := []interface{}{}
+		for _, v := range list {
+			resolved = append(resolved, resolve(v))
+		}
+		return resolved
+	}
+	return resolve(value)
+}
+
+// settingsFor returns the settings of the config for target, the settings of the deepest directory holding it win
+func (c *config) settingsFor(target string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for name, value := range c.settings {
+		result[name] = c.resolveSetting(name, value)
+	}
+
+	best := ""
+	for dir := range c.directories {
+		if (target == dir || strings.HasPrefix(target, dir+string(filepath.Separator))) && len(dir) > len(best) {
+			best = dir
+		}
+	}
+	if best != "" {
+		for name, value := range c.directories[best] {
+			result[name] = c.resolveSetting(name, value)
+		}
+	}
+
+	return result
+}
+
+func isFile(fileName string) bool {
+	stat, err := os.Stat(fileName)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+// configFiles returns the config files from the lowest to the highest priority,
+// the home config then the project configs from the root down to the current directory
+func configFiles() ([]string, error) {
+	if cfgFile != "" {
+		return []string{cfgFile}, nil
+	}
+
+	files := []string{}
+
+	if home, err := homedir.Dir(); err == nil {
+		for _, name := range homeConfigNames {
+			if fileName := filepath.Join(home, name); isFile(fileName) {
+				files = append(files, fileName)
+				break
+			}
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	project := []string{}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		fileName := filepath.Join(dir, projectConfigName)
+		if isFile(fileName) && !containsString(files, fileName) {
+			project = append([]string{fileName}, project...)
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	return append(files, project...), nil
+}
+
+// configTarget returns the absolute path the directory settings are looked up for,
+// the input file, the first path given or the current directory
+func configTarget(args []string) string {
+	target := input
+	if target == "" || target == "-" {
+		target = "."
+		if len(args) > 0 {
+			target, _ = splitGlob(args[0])
+		}
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return target
+	}
+	return abs
+}
+
+// knownSetting returns true if the setting is a flag of a command
+func knownSetting(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, child := range cmd.Commands() {
+		if knownSetting(child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig merges the config files and sets the flags that are not given on the command line
+func loadConfig(cmd *cobra.Command, args []string) error {
+	files, err := configFiles()
+	if err != nil {
+		return err
+	}
+
+	target := configTarget(args)
+	merged := map[string]interface{}{}
+	for _, fileName := range files {
+		c, err := readConfig(fileName)
+		if err != nil {
+			return err
+		}
+		for name, value := range c.settingsFor(target) {
+			merged[name] = value
+		}
+	}
+
+	keyGiven := false
+	for _, name := range keySettings {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			keyGiven = true
+		}
+	}
+
+	for name, value := range merged {
+		if keyGiven && containsString(keySettings, name) {
+			continue
+		}
+		if err = applySetting(cmd, name, value); err != nil {
+			return fmt.Errorf("config %s : %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func applySetting(cmd *cobra.Command, name string, value interface{}) error {
+	switch name {
+	case settingEditor:
+		configEditor = fmt.Sprint(value)
+		return nil
+	case settingYamlIndent:
+		indent, ok := value.(int)
+		if !ok || indent < 1 {
+			return fmt.Errorf("must be a positive number")
+		}
+		yamlIndent = indent
+		return nil
+	case "config", "input", "output":
+		return fmt.Errorf("can't be set in a config file")
+	}
+
+	if !knownSetting(cmd.Root(), name) {
+		return fmt.Errorf("unknown setting")
+	}
+
+	flag := cmd.Flags().Lookup(name)
+	// a flag of another command or given on the command line
+	if flag == nil || flag.Changed {
+		return nil
+	}
+
+	values := []interface{}{value}
+	if list, ok := value.([]interface{}); ok {
+		values = list
+	}
+	if len(values) != 1 && !strings.HasSuffix(flag.Value.Type(), "Array") {
+		return fmt.Errorf("a single value is expected")
+	}
+
+	for _, v := range values {
+		if err := flag.Value.Set(fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadAnsibleConfig uses the vault settings of ansible.cfg and ANSIBLE_VAULT_* env variables
+// when no key is given by the command line, the config files or the env variables of --env-key-prefix
+func loadAnsibleConfig() error {
+	if vaultKey != "" || vaultKeyFile != "" || vaultKeyExec != "" || len(vaultIDs) > 0 || vault.HasEnvKey(envKeyPrefix) {
+		return nil
+	}
+
+	c, err := vault.LoadAnsibleVaultConfig()
+	if err != nil {
+		return fmt.Errorf("ansible config : %w", err)
+	}
+
+	vaultIDs = c.VaultIDs()
+	if encryptVaultID == "" {
+		encryptVaultID = c.EncryptIdentity
+	}
+
+	return nil
+}
+
+// preferredEditor returns the editor set in the config or in the EDITOR env variable
+func preferredEditor() string {
+	if configEditor != "" {
+		return configEditor
+	}
+	return editor.GetPreferredEditorFromEnvironment()
+}
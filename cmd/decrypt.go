@@ -1,48 +1,109 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
 // decryptCmd represents the decrypt command
 var decryptCmd = &cobra.Command{
-	Use:   "decrypt",
+	Use:   "decrypt [path...]",
 	Short: "Decrypt file or var",
 	Long: `Decrypt encrypt file or var
 	encryption/decryption key can be provided with the --key flag
 	or into [env-key-prefix]_VAULT_PASSWORD_EXEC env var, if it's a file and executable , ot will be executed to get the key
 	or into [env-key-prefix]_VAULT_PASSWORD_FILE env var, if it'snt a file then it's taken as the key
+	several files, directories or globs are decrypted below the --output directory
 	`,
-	Run: func(cmd *cobra.Command, args []string) {
-		inputInfo, err := GetInputInfo(input, GetKeyFromFlags(), envKeyPrefix)
-		if err != nil {
-			panic(err)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if batchMode(args) {
+			return decryptBatch(args)
+		}
+		if len(args) > 0 {
+			input = args[0]
 		}
+		return reportFile(input, decryptFile)
+	},
+}
+
+// decryptBatch decrypts the files below the --output directory
+func decryptBatch(paths []string) error {
+	if output == "" || output == "-" {
+		return errors.New("decrypt : --output directory is required to decrypt several files")
+	}
+
+	files, err := listFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := batchOutputs(files)
+	if err != nil {
+		return err
+	}
+
+	identities, err := batchIdentities(false)
+	if err != nil {
+		return err
+	}
+
+	return runBatch("decrypt", files, func(result *fileResult) error {
+		return decryptPath(result, identities, outputs[result.File])
+	})
+}
+
+// decryptFile decrypts --input into --output
+func decryptFile(result *fileResult) error {
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		return err
+	}
 
-		err = inputInfo.Decrypt(doNotAskForKey, keyPrompt)
+	inputInfo, err := GetInputInfo(input, identities, encryptVaultID)
+	if err != nil {
+		return err
+	}
+
+	if inputInfo.isFile && inputInfo.original == nil {
+		return fmt.Errorf("decrypt : %s : %w", input, os.ErrNotExist)
+	}
+
+	result.describe(inputInfo.original, inputInfo.IsYaml())
+
+	err = inputInfo.Decrypt(doNotAskForKey, keyPrompt)
+	if err != nil {
+		return err
+	}
+
+	result.Status = statusUnchanged
+	if result.Version != "" || len(result.Entries) > 0 {
+		result.Status = statusDecrypted
+	}
+
+	decString := inputInfo.content
+
+	switch output {
+	case "", "-":
+		return result.writeStdout(decString)
+	default:
+		if output == input {
+			return errors.New("saving decrypted file : output file can't be the same as input")
+		}
+		result.Output = output
+		err = writeToFile(output, decString, inputInfo.fileMode)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("saving decrypted file : %w", err)
 		}
+	}
 
-		decString := string(inputInfo.content)
-
-		switch output {
-		case "", "-":
-			fmt.Print(decString)
-		default:
-			if output == input {
-				panic("saving decrypted file : output file can't be the same as input")
-			}
-			err = writeToFile(output, decString, inputInfo.fileMode)
-			if err != nil {
-				panic(fmt.Errorf("saving decrypted file : %w", err))
-			}
-		}
-	},
+	return nil
 }
 
 func init() {
+	addBatchFlags(decryptCmd)
+
 	rootCmd.AddCommand(decryptCmd)
 }
@@ -0,0 +1,6 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+const defaultPager = "more"
@@ -1,15 +1,13 @@
 package cmd
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strings"
 
 	"github.com/pleclech/ansible-vault-helper/editor"
 	"github.com/pleclech/ansible-vault-helper/vault"
@@ -17,47 +15,134 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var (
-	reYamlVaultEntry = regexp.MustCompile(`([^\S\r\n]*)(\w+):(\s+)[!]vault(.*)[\||>].*`)
-	reSpaces         = regexp.MustCompile(`(\s+)`)
-)
-
 type InputInfo struct {
 	content    []byte
 	isFile     bool
 	fileMode   os.FileMode
 	tmpFileExt string
 	fileExt    string
-	key        string
+	identities vault.Identities
+	// identity given by --encrypt-vault-id or rekey, it encrypts every vault
+	encryptID *vault.Identity
+	// first identity used to decrypt, it encrypts the file and new inline vaults back
+	decryptID *vault.Identity
+
+	// original content and plaintext of a vault file, used to keep the file untouched when unchanged,
+	// plaintext is nil unless the file was a whole-file vault
+	original  []byte
+	plaintext []byte
+	// the file was a whole-file vault, it's encrypted back as a whole
+	wholeFile bool
+	// inline yaml vaults as they were before decryption
+	decrypted []decryptedVault
+	// encrypt every vault even when its plaintext is unchanged
+	forceEncrypt bool
+}
+
+// decryptedVault is an inline yaml vault with its original text, plaintext and the identity that decrypted it
+type decryptedVault struct {
+	path      string
+	text      string
+	plaintext string
+	id        vault.Identity
+	used      bool
+}
+
+// previousVault returns the inline vault decrypted at the path of v, the one with the same plaintext first,
+// nil for a new vault
+func (i *InputInfo) previousVault(v *yamlVault) *decryptedVault {
+	var found *decryptedVault
+	for idx := range i.decrypted {
+		d := &i.decrypted[idx]
+		if d.used || d.path != v.path {
+			continue
+		}
+		if d.plaintext == v.value {
+			found = d
+			break
+		}
+		if found == nil {
+			found = d
+		}
+	}
+	if found != nil {
+		found.used = true
+	}
+	return found
+}
+
+// decrypt decrypts a vault, the first identity used is kept to encrypt back
+func (i *InputInfo) decrypt(content []byte) ([]byte, vault.Identity, error) {
+	result, id, err := i.identities.DecryptBytes(content)
+	if err != nil {
+		return nil, id, err
+	}
+	if i.decryptID == nil {
+		i.decryptID = &id
+	}
+	return result, id, nil
+}
+
+func (i *InputInfo) encryptIdentity() (*vault.Identity, error) {
+	if i.encryptID != nil {
+		return i.encryptID, nil
+	}
+	if i.decryptID != nil {
+		return i.decryptID, nil
+	}
+	switch len(i.identities) {
+	case 0:
+		return nil, vault.ErrNoIdentity
+	case 1:
+		return &i.identities[0], nil
+	}
+	return nil, fmt.Errorf("multiple vault-ids given, choose one with --encrypt-vault-id")
+}
+
+func (i *InputInfo) encrypt(content []byte, pad int) ([]byte, error) {
+	id, err := i.encryptIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return vault.EncryptBytes(content, id.Password, id.Label, pad)
+}
+
+// encryptVault encrypts an inline vault with the identity that decrypted it, unless one is forced
+func (i *InputInfo) encryptVault(content []byte, previous *decryptedVault) ([]byte, error) {
+	if i.encryptID != nil || previous == nil {
+		return i.encrypt(content, 0)
+	}
+	return vault.EncryptBytes(content, previous.id.Password, previous.id.Label, 0)
 }
 
 func (i *InputInfo) decryptYamlEntries() error {
-	content := string(i.content)
-	matches := reYamlVaultEntry.FindAllStringSubmatch(content, -1)
-	for _, match := range matches {
-		lMin := len(match[1])
-		pat := fmt.Sprintf(`%s(((\s{%d,})(.+))+)`, regexp.QuoteMeta(match[0]), lMin+2)
-		reN := regexp.MustCompile(pat)
-		values := reN.FindAllStringSubmatch(content, -1)
-		if len(values) > 0 {
-			value := values[0][1]
-			tmpValue := reSpaces.ReplaceAllString(value, "\n")[1:]
-			if vault.MaybeEncrypted(tmpValue) {
-				ic, err := vault.Decrypt(tmpValue, i.key)
-				if err != nil {
-					return err
-				}
-				sep := "\n" + strings.Repeat(" ", lMin+2)
-				var bb bytes.Buffer
-				for _, tmp := range strings.Split(ic, "\n") {
-					bb.WriteString(sep)
-					bb.WriteString(tmp)
-				}
-				content = strings.Replace(content, value, bb.String(), -1)
-			}
+	vaults, err := findYamlVaults(i.content)
+	if err != nil {
+		if bytes.Contains(i.content, []byte(yamlVaultTag)) {
+			return err
 		}
+		return nil
 	}
-	i.content = []byte(content)
+
+	replacements := []yamlReplacement{}
+	for _, v := range vaults {
+		if !v.IsEncrypted() {
+			continue
+		}
+		ic, id, err := i.decrypt([]byte(v.vaultText()))
+		if err != nil {
+			return fmt.Errorf("%s line %d : %w", v.path, v.line, err)
+		}
+		i.decrypted = append(i.decrypted, decryptedVault{
+			path:      v.path,
+			text:      string(i.content[v.start:v.end]),
+			plaintext: string(ic),
+			id:        id,
+		})
+		replacements = append(replacements, yamlReplacement{v.start, v.end, v.render(string(ic))})
+	}
+
+	i.content = applyYamlReplacements(i.content, replacements)
 	return nil
 }
 
@@ -65,75 +150,75 @@ func (i InputInfo) IsYaml() bool {
 	return i.tmpFileExt == ".yaml" || i.tmpFileExt == ".yml"
 }
 
-func (i *InputInfo) Encrypt() (string, error) {
-	content := string(i.content)
-	if !i.IsYaml() {
-		return vault.Encrypt(content, i.key, 0)
+func (i *InputInfo) Encrypt() ([]byte, error) {
+	if !i.forceEncrypt && i.plaintext != nil && bytes.Equal(i.content, i.plaintext) {
+		return i.original, nil
 	}
-	matches := reYamlVaultEntry.FindAllStringSubmatch(content, -1)
-	if len(matches) <= 0 {
-		return vault.Encrypt(content, i.key, 0)
+	// a whole-file vault is encrypted back as a whole, even when its plaintext holds inline vaults
+	if i.wholeFile || !i.IsYaml() {
+		return i.encrypt(i.content, 0)
 	}
-	for _, match := range matches {
-		lMin := len(match[1])
-		pat := fmt.Sprintf(`%s(((\s{%d,})(.+))+)`, regexp.QuoteMeta(match[0]), lMin+2)
-		reN := regexp.MustCompile(pat)
-		values := reN.FindAllStringSubmatch(content, -1)
-		if len(values) > 0 {
-			value := values[0][1]
-			var bb bytes.Buffer
-			sep := ""
-			for _, tmp := range strings.Split(value[1:], "\n") {
-				tmp = strings.TrimSpace(tmp)
-				bb.WriteString(sep)
-				bb.WriteString(tmp)
-				sep = "\n"
-			}
-			ic, err := vault.Encrypt(bb.String(), i.key, lMin+2)
-			if err != nil {
-				return content, err
-			}
-			content = strings.Replace(content, value, "\n"+ic, -1)
+	vaults, err := findYamlVaults(i.content)
+	if err != nil {
+		if bytes.Contains(i.content, []byte(yamlVaultTag)) {
+			return nil, err
+		}
+		return i.encrypt(i.content, 0)
+	}
+	if len(vaults) <= 0 {
+		return i.encrypt(i.content, 0)
+	}
+	replacements := []yamlReplacement{}
+	for _, v := range vaults {
+		if v.IsEncrypted() {
+			continue
+		}
+		previous := i.previousVault(v)
+		if previous != nil && !i.forceEncrypt && previous.plaintext == v.value {
+			replacements = append(replacements, yamlReplacement{v.start, v.end, previous.text})
+			continue
+		}
+		ic, err := i.encryptVault([]byte(v.value), previous)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d : %w", v.path, v.line, err)
 		}
+		replacements = append(replacements, yamlReplacement{v.start, v.end, v.render(string(ic) + "\n")})
 	}
-	return content, nil
+	return applyYamlReplacements(i.content, replacements), nil
 }
 
-func (i *InputInfo) Decrypt(doNotAskForKey bool, keyPrompt string) error {
-	var err error
+// checkEncrypted returns an error if the file was a whole-file vault and the output isn't one anymore
+func (i *InputInfo) checkEncrypted(output []byte) error {
+	if i.wholeFile && !vault.MaybeEncryptedBytes(output) {
+		return ErrNotEncrypted
+	}
+	return nil
+}
 
-	key := i.key
-	ic := string(i.content)
-	if vault.MaybeEncrypted(ic) {
-		if key == "" && !doNotAskForKey {
-			key, err = readPassword("Enter key", keyPrompt)
+func (i *InputInfo) Decrypt(doNotAskForKey bool, keyPrompt string) error {
+	if vault.MaybeEncryptedBytes(i.content) {
+		if len(i.identities) == 0 && !doNotAskForKey {
+			key, err := readPassword("Enter key", keyPrompt)
 			if err != nil {
 				return err
 			}
-			i.key = key
+			i.identities = append(i.identities, vault.Identity{Label: vault.DefaultLabel, Password: key})
 		}
-		ic, err = vault.Decrypt(ic, key)
+		ic, _, err := i.decrypt(i.content)
 		if err != nil {
 			return err
 		}
-		i.content = ([]byte)(ic)
+		i.content = ic
+		i.plaintext = ic
+		i.wholeFile = true
 	} else {
 		if i.isFile {
-			if key == "" && !doNotAskForKey {
-				key, err = readPassword("Enter new key", keyPrompt)
+			if len(i.identities) == 0 && !doNotAskForKey {
+				key, err := readNewPassword(keyPrompt)
 				if err != nil {
 					return err
 				}
-
-				key2, err := readPassword("Confirm new key", keyPrompt)
-				if err != nil {
-					return err
-				}
-
-				if key != key2 {
-					return fmt.Errorf("error password differs")
-				}
-				i.key = key
+				i.identities = append(i.identities, vault.Identity{Label: vault.DefaultLabel, Password: key})
 			}
 			switch i.tmpFileExt {
 			case ".yaml", ".yml":
@@ -144,67 +229,96 @@ func (i *InputInfo) Decrypt(doNotAskForKey bool, keyPrompt string) error {
 	return nil
 }
 
-func GetInputInfo(input string, keyChoice vault.Key, envKeyPrefix string) (*InputInfo, error) {
-	inputInfo := &InputInfo{}
+// newInputInfo returns an empty InputInfo using the identity labelled encryptLabel to encrypt
+func newInputInfo(identities vault.Identities, encryptLabel string) (*InputInfo, error) {
+	inputInfo := &InputInfo{identities: identities}
 
-	key, err := vault.GetKey(keyChoice, envKeyPrefix)
-	if err != nil {
-		panic(err)
+	if encryptLabel != "" {
+		id, ok := identities.Find(encryptLabel)
+		if !ok {
+			return inputInfo, fmt.Errorf("--encrypt-vault-id %s : %w", encryptLabel, vault.ErrUnknownVaultID)
+		}
+		inputInfo.encryptID = id
 	}
 
-	inputInfo.key = key
+	return inputInfo, nil
+}
+
+func GetInputInfo(input string, identities vault.Identities, encryptLabel string) (*InputInfo, error) {
+	inputInfo, err := newInputInfo(identities, encryptLabel)
+	if err != nil {
+		return inputInfo, err
+	}
 
 	switch input {
 	case "", "-":
-		var lines bytes.Buffer
-
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					lines.WriteString(line)
-				}
-				break
-			}
-			lines.WriteString(line)
+		inputInfo.content, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return inputInfo, err
 		}
-
-		inputInfo.content = lines.Bytes()
+		inputInfo.original = inputInfo.content
 	default:
 		stat, err := os.Stat(input)
 
 		inputInfo.isFile = true
 
-		if os.IsNotExist(err) {
+		switch {
+		case os.IsNotExist(err):
 			inputInfo.fileMode = vault.DefaultFileMode
-		} else {
+		case err != nil:
+			return inputInfo, err
+		default:
 			inputInfo.fileMode = stat.Mode()
 			inputInfo.content, err = ioutil.ReadFile(input)
 			if err != nil {
 				return inputInfo, err
 			}
+			inputInfo.original = inputInfo.content
 		}
 
-		inputInfo.fileExt = filepath.Ext(input)
-		inputInfo.tmpFileExt = filepath.Ext(input[0 : len(input)-len(inputInfo.fileExt)])
-		if inputInfo.tmpFileExt == "" {
-			inputInfo.tmpFileExt = inputInfo.fileExt
-		} else {
-			switch inputInfo.fileExt {
-			case ".yaml", ".yml":
-				inputInfo.tmpFileExt = inputInfo.fileExt
-			}
-		}
+		inputInfo.setFileExt(input)
 	}
 
 	return inputInfo, nil
 }
 
-func Edit(cmd *cobra.Command, args []string, openEditor bool) {
-	inputInfo, err := GetInputInfo(input, GetKeyFromFlags(), envKeyPrefix)
+// setFileExt sets the extensions from the file name, a.yml.vault is edited as a .yml file
+func (i *InputInfo) setFileExt(fileName string) {
+	i.fileExt = filepath.Ext(fileName)
+	i.tmpFileExt = filepath.Ext(fileName[0 : len(fileName)-len(i.fileExt)])
+	if i.tmpFileExt == "" {
+		i.tmpFileExt = i.fileExt
+	} else {
+		switch i.fileExt {
+		case ".yaml", ".yml":
+			i.tmpFileExt = i.fileExt
+		}
+	}
+}
+
+var allowDiskTemp bool
+
+func Edit(cmd *cobra.Command, args []string, openEditor bool) error {
+	return reportFile(input, func(result *fileResult) error {
+		return editFile(result, openEditor)
+	})
+}
+
+// editFile decrypts --input, opens the editor if asked and encrypts the result into --output
+func editFile(result *fileResult, openEditor bool) error {
+	identities, err := GetIdentitiesFromFlags()
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	inputInfo, err := GetInputInfo(input, identities, encryptVaultID)
+	if err != nil {
+		return err
+	}
+
+	// only edit creates a file
+	if !openEditor && inputInfo.isFile && inputInfo.original == nil {
+		return fmt.Errorf("encrypt : %s : %w", input, os.ErrNotExist)
 	}
 
 	if inputInfo.isFile && output == "" {
@@ -215,37 +329,59 @@ func Edit(cmd *cobra.Command, args []string, openEditor bool) {
 
 	err = inputInfo.Decrypt(doNotAskForKey, keyPrompt)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	var editedBytes []byte
 
 	if openEditor {
 		editedBytes, err = editor.CaptureInputFromEditor(
-			editor.GetPreferredEditorFromEnvironment,
+			preferredEditor,
 			inputInfo.content,
 			ext,
+			allowDiskTemp,
 		)
+		if errors.Is(err, editor.ErrNoSecureTempDir) {
+			return fmt.Errorf("%w, use --allow-disk-temp to write plaintext in %s", err, os.TempDir())
+		}
+		// nothing is saved when the editor exits with an error, as with :cq in vim
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("editor %s : %w", exitErr, ErrAborted)
+		}
 		if err != nil {
-			panic(err)
+			return err
 		}
 		inputInfo.content = editedBytes
 	}
 
 	encString, err := inputInfo.Encrypt()
 	if err != nil {
-		panic(fmt.Errorf("encrypt : %w", err))
+		return fmt.Errorf("encrypt : %w", err)
+	}
+
+	result.describe(encString, inputInfo.IsYaml())
+	result.Status = statusEncrypted
+	if inputInfo.original != nil && bytes.Equal(encString, inputInfo.original) {
+		result.Status = statusUnchanged
 	}
 
 	switch output {
 	case "", "-":
-		fmt.Print(encString)
+		return result.writeStdout(encString)
 	default:
+		result.Output = output
+		// an unchanged file is not rewritten
+		if output == input && result.Status == statusUnchanged {
+			return nil
+		}
 		err = writeToFile(output, encString, inputInfo.fileMode)
 		if err != nil {
-			panic(fmt.Errorf("saving encrypted file : %w", err))
+			return fmt.Errorf("saving encrypted file : %w", err)
 		}
 	}
+
+	return nil
 }
 
 // editCmd represents the edit command
@@ -257,11 +393,13 @@ var editCmd = &cobra.Command{
 	or into [env-key-prefix]_VAULT_PASSWORD_EXEC env var, if it's a file and executable , ot will be executed to get the key
 	or into [env-key-prefix]_VAULT_PASSWORD_FILE env var, if it'snt a file then it's taken as the key
 	`,
-	Run: func(cmd *cobra.Command, args []string) {
-		Edit(cmd, args, true)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Edit(cmd, args, true)
 	},
 }
 
 func init() {
+	editCmd.Flags().BoolVar(&allowDiskTemp, "allow-disk-temp", false, "allow plaintext to be written in a disk backed temporary directory when no RAM backed one is found")
+
 	rootCmd.AddCommand(editCmd)
 }
@@ -1,23 +1,60 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/spf13/cobra"
 )
 
 // encryptCmd represents the encrypt command
 var encryptCmd = &cobra.Command{
-	Use:   "encrypt",
+	Use:   "encrypt [path...]",
 	Short: "Encrypt a file or a variable for being encrypted",
 	Long: `Encrypt a file or a variable for being encrypted
 	encryption/decryption key can be provided with the --key flag
 	or into [env-key-prefix]_VAULT_PASSWORD_EXEC env var, if it's a file and executable , ot will be executed to get the key
 	or into [env-key-prefix]_VAULT_PASSWORD_FILE env var, if it'snt a file then it's taken as the key
+	several files, directories or globs are encrypted in place or below the --output directory
 	`,
-	Run: func(cmd *cobra.Command, args []string) {
-		Edit(cmd, args, false)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if batchMode(args) {
+			return encryptBatch(args)
+		}
+		if len(args) > 0 {
+			input = args[0]
+		}
+		return Edit(cmd, args, false)
 	},
 }
 
+// encryptBatch encrypts the files in place or below the --output directory
+func encryptBatch(paths []string) error {
+	if output == "-" {
+		return errors.New("encrypt : --output must be a directory to encrypt several files")
+	}
+
+	files, err := listFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := batchOutputs(files)
+	if err != nil {
+		return err
+	}
+
+	identities, err := batchIdentities(true)
+	if err != nil {
+		return err
+	}
+
+	return runBatch("encrypt", files, func(result *fileResult) error {
+		return encryptPath(result, identities, outputs[result.File])
+	})
+}
+
 func init() {
+	addBatchFlags(encryptCmd)
+
 	rootCmd.AddCommand(encryptCmd)
 }
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	stringName, stringValue string
+	stringIndent            int
+)
+
+// readStringValue returns the value to encrypt from --value, stdin or a hidden prompt
+func readStringValue() (string, error) {
+	if stringValue != "" {
+		return stringValue, nil
+	}
+
+	if input == "-" || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := ioutil.ReadAll(os.Stdin)
+		return string(value), err
+	}
+
+	label := "Enter value"
+	if stringName != "" {
+		label = fmt.Sprintf("Enter value for %s", stringName)
+	}
+	return readPassword(label, "")
+}
+
+// yamlKey returns the name as a yaml string key, quoted when it is needed
+func yamlKey(name string) (string, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}
+	if strings.ContainsAny(name, "\r\n") {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	key, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(key), "\n"), nil
+}
+
+// yamlVaultEntry formats an encrypted value as a yaml entry indented by indent spaces
+// the vault is indented yaml-indent spaces deeper than the name
+func yamlVaultEntry(name string, encrypted string, indent int) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(strings.Repeat(" ", indent))
+	if name != "" {
+		key, err := yamlKey(name)
+		if err != nil {
+			return "", fmt.Errorf("--name %s : %w", name, err)
+		}
+		sb.WriteString(key)
+		sb.WriteString(": ")
+	}
+	sb.WriteString("!vault |\n")
+	sb.WriteString(encrypted)
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+// encryptStringCmd represents the encrypt-string command
+var encryptStringCmd = &cobra.Command{
+	Use:   "encrypt-string",
+	Short: "Encrypt a value as a yaml !vault entry",
+	Long: `Encrypt a value as a yaml !vault entry ready to be pasted in a yaml file
+	value is taken from --value, from stdin if it's not a terminal or asked for
+	encryption key can be provided with the --key flag or --vault-id with --encrypt-vault-id
+	or into [env-key-prefix]_VAULT_PASSWORD_EXEC env var, if it's a file and executable , ot will be executed to get the key
+	or into [env-key-prefix]_VAULT_PASSWORD_FILE env var, if it'snt a file then it's taken as the key
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reportFile(input, encryptString)
+	},
+}
+
+// encryptString encrypts the value as a yaml entry
+func encryptString(result *fileResult) error {
+	if stringIndent < 0 {
+		return errors.New("encrypt-string : --indent can't be negative")
+	}
+
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		return err
+	}
+
+	inputInfo, err := newInputInfo(identities, encryptVaultID)
+	if err != nil {
+		return err
+	}
+
+	value, err := readStringValue()
+	if err != nil {
+		return err
+	}
+
+	if len(inputInfo.identities) == 0 && !doNotAskForKey {
+		key, err := readNewPassword(keyPrompt)
+		if err != nil {
+			return err
+		}
+		inputInfo.identities = append(inputInfo.identities, vault.Identity{Label: vault.DefaultLabel, Password: key})
+	}
+
+	encString, err := inputInfo.encrypt([]byte(value), stringIndent+yamlIndent)
+	if err != nil {
+		return fmt.Errorf("encrypt : %w", err)
+	}
+
+	entry, err := yamlVaultEntry(stringName, string(encString), stringIndent)
+	if err != nil {
+		return err
+	}
+
+	result.Status = statusEncrypted
+	result.Version, result.Label = headerInfo(encString)
+	if stringName != "" {
+		result.Entries = append(result.Entries, &entryResult{Path: stringName, Line: 1, Version: result.Version, Label: result.Label})
+	}
+
+	switch output {
+	case "", "-":
+		return result.writeStdout([]byte(entry))
+	default:
+		result.Output = output
+		err = writeToFile(output, []byte(entry), vault.DefaultFileMode)
+		if err != nil {
+			return fmt.Errorf("saving encrypted string : %w", err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	f := encryptStringCmd.Flags()
+	f.StringVarP(&stringName, "name", "n", "", "name of the yaml entry")
+	f.StringVar(&stringValue, "value", "", "value to encrypt")
+	f.IntVar(&stringIndent, "indent", 0, "number of spaces in front of the name")
+
+	rootCmd.AddCommand(encryptStringCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYamlVaultEntryName(t *testing.T) {
+	encrypted, err := (&InputInfo{identities: testIdentities("pw")}).encrypt([]byte("secret"), yamlIndent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"plain", "a: b", "a:b", "#comment", "- item", "-x", "has space", "true", "123", "null", "it's", "a\nb", "{x}", "*alias", "&anchor", "!tag", "?q"} {
+		entry, err := yamlVaultEntry(name, string(encrypted), 0)
+		if err != nil {
+			t.Fatalf("%q : %v", name, err)
+		}
+
+		var doc yaml.Node
+		if err = yaml.Unmarshal([]byte(entry), &doc); err != nil {
+			t.Errorf("%q : invalid yaml %v\n%s", name, err, entry)
+			continue
+		}
+
+		mapping := doc.Content[0]
+		if mapping.Kind != yaml.MappingNode || len(mapping.Content) != 2 {
+			t.Errorf("%q : not a single entry mapping\n%s", name, entry)
+			continue
+		}
+		if key := mapping.Content[0]; key.Value != name || key.ShortTag() != "!!str" {
+			t.Errorf("%q : got key %q tagged %s", name, key.Value, key.ShortTag())
+		}
+		if value := mapping.Content[1]; value.Tag != yamlVaultTag {
+			t.Errorf("%q : got value tagged %s", name, value.Tag)
+		}
+	}
+}
+
+// testIdentities returns the default identity with the password
+func testIdentities(password string) vault.Identities {
+	return vault.Identities{{Label: vault.DefaultLabel, Password: password}}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pleclech/ansible-vault-helper/keystore"
+	"github.com/pleclech/ansible-vault-helper/vault"
+)
+
+// exit codes of avh, see the readme
+const (
+	ExitOK            = 0
+	ExitError         = 1
+	ExitWrongPassword = 3
+	ExitInvalidFormat = 4
+	ExitMissingKey    = 5
+	ExitIOError       = 6
+	ExitAborted       = 130
+)
+
+var (
+	// ErrAborted is returned when the user aborts a prompt or the editor
+	ErrAborted = errors.New("aborted")
+
+	// ErrNoTerminal is returned when a key has to be asked for without a terminal
+	ErrNoTerminal = errors.New("no terminal to ask for the key, use --key-file, --key-exec or --vault-id")
+
+	// ErrNotEncrypted is returned when a whole-file vault would be written back unencrypted
+	ErrNotEncrypted = errors.New("whole-file vault would be written unencrypted")
+)
+
+// exitCode returns the exit code matching the error
+func exitCode(err error) int {
+	var pathErr *os.PathError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrAborted):
+		return ExitAborted
+	case errors.Is(err, vault.ErrInvalidPassword):
+		return ExitWrongPassword
+	case errors.Is(err, vault.ErrInvalidFormat),
+		errors.Is(err, vault.ErrInvalidPadding),
+		errors.Is(err, vault.ErrEmptyCiphertext),
+		errors.Is(err, vault.ErrUnsupportedVersion),
+		errors.Is(err, vault.ErrUnsupportedCipher):
+		return ExitInvalidFormat
+	case errors.Is(err, vault.ErrEmptyPassword),
+		errors.Is(err, vault.ErrNoIdentity),
+		errors.Is(err, vault.ErrUnknownVaultID),
+		errors.Is(err, vault.ErrKeyFileNotFound),
+		errors.Is(err, vault.ErrKeyFileNotExec),
+		errors.Is(err, vault.ErrKeyExecFailed),
+		errors.Is(err, vault.ErrInvalidKeyring),
+		errors.Is(err, vault.ErrUnwrapKey),
+		errors.Is(err, keystore.ErrNotFound),
+		errors.Is(err, keystore.ErrNoSecretService),
+		errors.Is(err, keystore.ErrPromptTimeout),
+		errors.Is(err, ErrNoTerminal):
+		return ExitMissingKey
+	case errors.As(err, &pathErr), errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		return ExitIOError
+	}
+
+	return ExitError
+}
+
+// warn prints a warning on stderr, the json report is kept clean on stdout
+func warn(message string) {
+	fmt.Fprintf(os.Stderr, "avh : warning : %s\n", message)
+}
+
+func init() {
+	vault.Warn = warn
+}
+
+// exit prints the error on one line and exits with its code
+func exit(err error) {
+	fmt.Fprintf(os.Stderr, "avh : %s\n", err)
+	os.Exit(exitCode(err))
+}
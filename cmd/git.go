@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	gitDriverName     = "avh"
+	gitAttributesFile = ".gitattributes"
+
+	// gitDriverAnnotation marks the commands run by git, their stdout is the payload git reads
+	gitDriverAnnotation = "git-driver"
+)
+
+var (
+	gitPatterns        []string
+	gitAvhPath         string
+	gitGlobalConfig    bool
+	defaultGitPatterns = []string{"*.vault", "*.vault.*", "vault.yml", "vault.yaml"}
+)
+
+// gitDriver marks the command as run by git, it never prints the json report
+func gitDriver(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[gitDriverAnnotation] = "true"
+	return cmd
+}
+
+// runGit runs git with the arguments and returns its trimmed stdout
+func runGit(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s : %s : %w", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// setGitConfig sets a git config entry in the repository config or the global one
+func setGitConfig(name, value string) error {
+	args := []string{"config"}
+	if gitGlobalConfig {
+		args = append(args, "--global")
+	}
+	_, err := runGit(append(args, name, value)...)
+	return err
+}
+
+// shellQuote quotes an argument for the shell git uses to run drivers
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./@%=:+,", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// gitDriverCommand returns the avh command line run by git, key flags given to git-setup are kept
+// a raw --key is never written in a git config
+func gitDriverCommand(subCommand string, args ...string) string {
+	parts := []string{shellQuote(gitAvhPath)}
+
+	if envKeyPrefix != "DEFAULT" {
+		parts = append(parts, "--env-key-prefix", shellQuote(envKeyPrefix))
+	}
+	if vaultKeyExec != "" {
+		parts = append(parts, "--key-exec", shellQuote(absPath(vaultKeyExec)))
+	}
+	if vaultKeyFile != "" {
+		parts = append(parts, "--key-file", shellQuote(absPath(vaultKeyFile)))
+	}
+	for _, vaultID := range vaultIDs {
+		parts = append(parts, "--vault-id", shellQuote(absVaultID(vaultID)))
+	}
+	if encryptVaultID != "" {
+		parts = append(parts, "--encrypt-vault-id", shellQuote(encryptVaultID))
+	}
+
+	parts = append(parts, subCommand)
+	return strings.Join(append(parts, args...), " ")
+}
+
+func absPath(fileName string) string {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		return abs
+	}
+	return fileName
+}
+
+// absVaultID makes the source of a label@source vault-id absolute
+func absVaultID(vaultID string) string {
+	key, err := vault.ParseVaultID(vaultID)
+	if err != nil || !key.IsFile {
+		return vaultID
+	}
+	return key.Label + "@" + absPath(key.Value)
+}
+
+// addGitAttributes adds the attributes to every pattern of the .gitattributes file at the root of the repository
+func addGitAttributes(root string, patterns []string, attributes []string) error {
+	fileName := filepath.Join(root, gitAttributesFile)
+
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := []string{}
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	}
+
+	for _, pattern := range patterns {
+		found := false
+		for idx, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || fields[0] != pattern {
+				continue
+			}
+			found = true
+			for _, attribute := range attributes {
+				if !containsString(fields[1:], attribute) {
+					fields = append(fields, attribute)
+				}
+			}
+			lines[idx] = strings.Join(fields, " ")
+		}
+		if !found {
+			lines = append(lines, strings.Join(append([]string{pattern}, attributes...), " "))
+		}
+	}
+
+	mode := os.FileMode(vault.DefaultFileMode)
+	if stat, err := os.Stat(fileName); err == nil {
+		mode = stat.Mode()
+	}
+
+	return writeToFile(fileName, []byte(strings.Join(lines, "\n")+"\n"), mode)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// gitSetupCmd represents the git-setup command
+var gitSetupCmd = &cobra.Command{
+	Use:   "git-setup",
+	Short: "Configure git to diff and merge decrypted vaults",
+	Long: `Configure git to diff and merge decrypted vaults
+	the avh diff and merge drivers are declared in the git config of the repository (or the global one with --global)
+	and set in .gitattributes for every --pattern
+	with --filter the avh clean/smudge filter is set too, vaults are then decrypted in the working tree
+	key flags given to git-setup, except a raw --key, are kept in the driver command
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := runGit("rev-parse", "--show-toplevel")
+		if err != nil {
+			return err
+		}
+
+		if vaultKey != "" {
+			fmt.Fprintln(os.Stderr, "git-setup : --key is not written in git config, use --key-file, --key-exec, --vault-id or env variables")
+		}
+
+		driver := "diff." + gitDriverName
+		if err = setGitConfig(driver+".textconv", gitDriverCommand("git-diff")); err != nil {
+			return err
+		}
+		// cached textconv output would store plaintext in git notes
+		if err = setGitConfig(driver+".cachetextconv", "false"); err != nil {
+			return err
+		}
+
+		driver = "merge." + gitDriverName
+		if err = setGitConfig(driver+".name", "ansible vault merge"); err != nil {
+			return err
+		}
+		if err = setGitConfig(driver+".driver", gitDriverCommand("git-merge", "%O", "%A", "%B", "%P")); err != nil {
+			return err
+		}
+
+		attributes := []string{"diff=" + gitDriverName, "merge=" + gitDriverName}
+
+		if gitFilter {
+			driver = "filter." + gitDriverName
+			if err = setGitConfig(driver+".clean", gitDriverCommand("git-clean", "%f")); err != nil {
+				return err
+			}
+			if err = setGitConfig(driver+".smudge", gitDriverCommand("git-smudge", "%f")); err != nil {
+				return err
+			}
+			// plaintext must never be committed when the clean filter fails
+			if err = setGitConfig(driver+".required", "true"); err != nil {
+				return err
+			}
+			attributes = append(attributes, "filter="+gitDriverName)
+		}
+		if err = addGitAttributes(root, gitPatterns, attributes); err != nil {
+			return err
+		}
+
+		if !jsonOutput() {
+			fmt.Printf("git drivers %s set for %s\n", gitDriverName, strings.Join(gitPatterns, " "))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	avhPath, err := os.Executable()
+	if err != nil {
+		avhPath = "avh"
+	}
+
+	f := gitSetupCmd.Flags()
+	f.StringArrayVar(&gitPatterns, "pattern", defaultGitPatterns, "gitattributes pattern of the vault files, can be repeated")
+	f.StringVar(&gitAvhPath, "avh-path", avhPath, "avh command run by git")
+	f.BoolVar(&gitGlobalConfig, "global", false, "declare the drivers in the global git config")
+	f.BoolVar(&gitFilter, "filter", false, "set the clean/smudge filter to keep vaults decrypted in the working tree")
+
+	rootCmd.AddCommand(gitSetupCmd)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// decryptForGit returns the file content with its vaults decrypted without asking for a key
+// the content is returned as is with a warning when it can't be decrypted
+func decryptForGit(fileName string) ([]byte, error) {
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "avh : %s : %s\n", fileName, err)
+	}
+
+	inputInfo, err := GetInputInfo(fileName, identities, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !inputInfo.HasVault() {
+		return inputInfo.content, nil
+	}
+
+	original := inputInfo.content
+	if err = inputInfo.Decrypt(true, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "avh : %s : %s\n", fileName, err)
+		return original, nil
+	}
+
+	return inputInfo.content, nil
+}
+
+// gitDiffCmd represents the git-diff command
+var gitDiffCmd = &cobra.Command{
+	Use:   "git-diff file",
+	Short: "Print a file with its vaults decrypted, used as git diff textconv",
+	Long: `Print a file with its vaults decrypted, inline yaml vaults are expanded in place
+	used by git as the textconv command of the avh diff driver, see git-setup
+	the key is never asked for, a file that can't be decrypted is printed as is
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		content, err := decryptForGit(args[0])
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(content)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitDriver(gitDiffCmd))
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+var gitFilter bool
+
+// gitBlob returns the content of the file as staged, or as committed in HEAD
+func gitBlob(pathName string) ([]byte, error) {
+	var err error
+	for _, rev := range []string{":", "HEAD:"} {
+		var stdout bytes.Buffer
+		cmd := exec.Command("git", "cat-file", "blob", rev+pathName)
+		cmd.Stdout = &stdout
+		if err = cmd.Run(); err == nil {
+			return stdout.Bytes(), nil
+		}
+	}
+	return nil, err
+}
+
+// filterInputInfo returns the InputInfo of a file content given by git
+func filterInputInfo(content []byte, pathName string, identities vault.Identities) (*InputInfo, error) {
+	inputInfo, err := newInputInfo(identities, encryptVaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	inputInfo.content = content
+	inputInfo.original = content
+	inputInfo.isFile = true
+	inputInfo.setFileExt(pathName)
+
+	return inputInfo, nil
+}
+
+// cleanFilter encrypts the plaintext of the working tree file
+// vaults whose plaintext is the same as in the staged or committed version keep their ciphertext
+func cleanFilter(content []byte, pathName string, identities vault.Identities) ([]byte, error) {
+	if vault.MaybeEncryptedBytes(content) {
+		return content, nil
+	}
+
+	inputInfo, err := filterInputInfo(content, pathName, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	if committed, err := gitBlob(pathName); err == nil {
+		previous, err := filterInputInfo(committed, pathName, identities)
+		if err == nil && previous.HasVault() {
+			err = previous.Decrypt(true, "")
+			// without the key the file can't be told to be encrypted as a whole, as committed
+			if err != nil && vault.MaybeEncryptedBytes(committed) {
+				return nil, fmt.Errorf("%s is committed as a whole-file vault : %w", pathName, err)
+			}
+			if err == nil {
+				inputInfo.original = previous.original
+				inputInfo.plaintext = previous.plaintext
+				inputInfo.wholeFile = previous.wholeFile
+				inputInfo.decrypted = previous.decrypted
+				inputInfo.decryptID = previous.decryptID
+			}
+		}
+	}
+
+	result, err := inputInfo.Encrypt()
+	if err != nil {
+		return nil, err
+	}
+
+	// a whole-file vault must never reach the index in cleartext
+	if err = inputInfo.checkEncrypted(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// smudgeFilter decrypts the vaults of the committed file, it is returned as is when it can't be decrypted
+func smudgeFilter(content []byte, pathName string, identities vault.Identities) ([]byte, error) {
+	inputInfo, err := filterInputInfo(content, pathName, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inputInfo.HasVault() {
+		return content, nil
+	}
+
+	if err = inputInfo.Decrypt(true, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "avh git-smudge : %s : %s\n", pathName, err)
+		return content, nil
+	}
+
+	return inputInfo.content, nil
+}
+
+// runGitFilter runs a filter from stdin to stdout
+func runGitFilter(filter func([]byte, string, vault.Identities) ([]byte, error), pathName string) error {
+	content, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		return err
+	}
+
+	result, err := filter(content, pathName, identities)
+	if err != nil {
+		return fmt.Errorf("%s : %w", pathName, err)
+	}
+
+	_, err = os.Stdout.Write(result)
+	return err
+}
+
+// gitCleanCmd represents the git-clean command
+var gitCleanCmd = &cobra.Command{
+	Use:   "git-clean path",
+	Short: "Encrypt stdin to stdout, used as git clean filter",
+	Long: `Encrypt the working tree content read from stdin to stdout, used as the clean filter of the avh git filter
+	vaults whose plaintext is unchanged keep the ciphertext staged or committed, so git doesn't see them as modified
+	content already encrypted is kept as is, the key is never asked for
+	it fails when the file is staged or committed as a whole-file vault that can't be decrypted
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGitFilter(cleanFilter, args[0])
+	},
+}
+
+// gitSmudgeCmd represents the git-smudge command
+var gitSmudgeCmd = &cobra.Command{
+	Use:   "git-smudge path",
+	Short: "Decrypt stdin to stdout, used as git smudge filter",
+	Long: `Decrypt the committed content read from stdin to stdout, used as the smudge filter of the avh git filter
+	content that can't be decrypted is kept as is, the key is never asked for
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGitFilter(smudgeFilter, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitDriver(gitCleanCmd))
+	rootCmd.AddCommand(gitDriver(gitSmudgeCmd))
+}
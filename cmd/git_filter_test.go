@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+)
+
+// gitRepo creates a repository in a temporary directory and makes it the working directory,
+// the returned function restores the working directory and removes the repository
+func gitRepo(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "avh-git-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+
+	if err = os.Chdir(dir); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		cleanup()
+		t.Fatalf("git init : %v : %s", err, output)
+	}
+
+	return dir, cleanup
+}
+
+// gitCommit commits the content of the file
+func gitCommit(t *testing.T, pathName string, content string) {
+	if err := ioutil.WriteFile(pathName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"add", pathName},
+		{"-c", "user.name=avh", "-c", "user.email=avh@example.com", "commit", "-q", "-m", pathName},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s : %v : %s", args[0], err, output)
+		}
+	}
+}
+
+// a file committed as a whole-file vault must never be staged with its inline vaults only encrypted
+func TestCleanFilterWholeFileVault(t *testing.T) {
+	_, cleanup := gitRepo(t)
+	defer cleanup()
+
+	inline, err := vault.Encrypt("inner", "pw", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := "user: admin\npassword: !vault |\n  " + strings.Replace(inline, "\n", "\n  ", -1) + "\n"
+	identities := testIdentities("pw")
+
+	// the committed vault can't be decrypted with the identities
+	committed, err := vault.Encrypt("user: admin\n", "other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitCommit(t, "locked.yml", committed)
+
+	result, err := cleanFilter([]byte(plaintext), "locked.yml", identities)
+	if err == nil {
+		t.Errorf("undecryptable vault : got no error")
+	}
+	if bytes.Contains(result, []byte("admin")) {
+		t.Errorf("undecryptable vault : cleartext staged:\n%s", result)
+	}
+
+	// the committed vault is encrypted back as a whole
+	if committed, err = vault.Encrypt("user: admin\n", "pw", 0); err != nil {
+		t.Fatal(err)
+	}
+	gitCommit(t, "secrets.yml", committed)
+
+	if result, err = cleanFilter([]byte(plaintext), "secrets.yml", identities); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := vault.Decrypt(string(result), "pw")
+	if err != nil || decrypted != plaintext {
+		t.Errorf("whole-file vault : got %q, %v", decrypted, err)
+	}
+}
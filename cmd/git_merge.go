@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pleclech/ansible-vault-helper/diff3"
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+// mergeVersion is a version of a merged file with its vaults decrypted
+type mergeVersion struct {
+	*InputInfo
+	hasVault bool
+}
+
+// loadMergeVersion reads a version of the merged file, pathName gives the real extension of the file
+func loadMergeVersion(fileName, pathName string, identities vault.Identities) (*mergeVersion, error) {
+	inputInfo, err := GetInputInfo(fileName, identities, encryptVaultID)
+	if err != nil {
+		return nil, err
+	}
+	inputInfo.setFileExt(pathName)
+
+	version := &mergeVersion{
+		InputInfo: inputInfo,
+		hasVault:  inputInfo.HasVault(),
+	}
+
+	if version.hasVault {
+		if err = inputInfo.Decrypt(true, ""); err != nil {
+			return nil, fmt.Errorf("%s : %w", fileName, err)
+		}
+	}
+
+	return version, nil
+}
+
+// mergeVaults merges the decrypted versions and returns the encrypted result and the number of conflicts
+func mergeVaults(base, ours, theirs *mergeVersion) ([]byte, int, error) {
+	merged, conflicts := diff3.Merge(base.content, ours.content, theirs.content, diff3.Labels{Ours: "ours", Theirs: "theirs"})
+
+	if !ours.hasVault && !theirs.hasVault {
+		return merged, conflicts, nil
+	}
+
+	// the result is encrypted as ours unless ours has no vault
+	ctx, other := ours, theirs
+	if !ours.hasVault {
+		ctx, other = theirs, ours
+	}
+
+	if ctx.wholeFile {
+		switch {
+		case ctx.plaintext != nil && bytes.Equal(merged, ctx.plaintext):
+			return ctx.original, conflicts, nil
+		case other.wholeFile && bytes.Equal(merged, other.plaintext):
+			return other.original, conflicts, nil
+		}
+		encString, err := ctx.encrypt(merged, 0)
+		return encString, conflicts, err
+	}
+
+	// conflict markers can't be kept inside inline vaults, the yaml would be invalid
+	if conflicts > 0 {
+		return nil, conflicts, fmt.Errorf("%d conflict(s) in a yaml file with inline vaults", conflicts)
+	}
+
+	vaults, err := findYamlVaults(merged)
+	if err != nil {
+		return nil, conflicts, err
+	}
+	if len(vaults) == 0 {
+		return merged, conflicts, nil
+	}
+
+	ctx.content = merged
+	ctx.decrypted = append(ctx.decrypted, other.decrypted...)
+
+	encString, err := ctx.Encrypt()
+	return encString, conflicts, err
+}
+
+// gitMergeCmd represents the git-merge command
+var gitMergeCmd = &cobra.Command{
+	Use:   "git-merge base ours theirs [path]",
+	Short: "Merge decrypted vaults, used as git merge driver",
+	Long: `Merge the three versions of a vault file or of a yaml file with inline vaults once decrypted
+	used by git as the avh merge driver with %O %A %B %P, see git-setup
+	the result is encrypted and written into ours, conflict markers are kept encrypted in vault files
+	for yaml files with inline vaults, ours is left untouched when there are conflicts
+	the key is never asked for, the merge fails when a version can't be decrypted
+	`,
+	Args: cobra.RangeArgs(3, 4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pathName := args[1]
+		if len(args) > 3 {
+			pathName = args[3]
+		}
+
+		identities, err := GetIdentitiesFromFlags()
+		if err != nil {
+			return fmt.Errorf("git-merge : %s : %w", pathName, err)
+		}
+
+		versions := []*mergeVersion{}
+		for _, fileName := range args[:3] {
+			version, err := loadMergeVersion(fileName, pathName, identities)
+			if err != nil {
+				return fmt.Errorf("git-merge : %s : %w", pathName, err)
+			}
+			versions = append(versions, version)
+		}
+
+		result, conflicts, err := mergeVaults(versions[0], versions[1], versions[2])
+		if err != nil {
+			return fmt.Errorf("git-merge : %s : %w", pathName, err)
+		}
+
+		if err = writeToFile(args[1], result, versions[1].fileMode); err != nil {
+			return fmt.Errorf("git-merge : %s : %w", pathName, err)
+		}
+
+		if conflicts > 0 {
+			return fmt.Errorf("git-merge : %s : %d conflict(s), resolve them with avh edit", pathName, conflicts)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gitDriver(gitMergeCmd))
+}
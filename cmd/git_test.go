@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// the json report must never be appended to the content git reads
+func TestGitDriversIgnoreJSONOutput(t *testing.T) {
+	defer func(format string) { outputFormat = format }(outputFormat)
+
+	for _, cmd := range []*cobra.Command{gitDiffCmd, gitCleanCmd, gitSmudgeCmd, gitMergeCmd} {
+		outputFormat = outputFormatJSON
+		if err := rootCmd.PersistentPreRunE(cmd, nil); err != nil {
+			t.Fatalf("%s : %v", cmd.Name(), err)
+		}
+		if jsonOutput() {
+			t.Errorf("%s : json output is enabled", cmd.Name())
+		}
+	}
+
+	outputFormat = outputFormatJSON
+	if err := rootCmd.PersistentPreRunE(versionCmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !jsonOutput() {
+		t.Error("version : json output is disabled")
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const gitIgnoreFile = ".gitignore"
+
+// matchPath matches a slash separated name against a pattern where ** matches any number of directories
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchName matches a pattern against the base name when it has no slash, against the whole relative name otherwise
+func matchName(pattern, rel string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		return matchPath(pattern[1:], rel)
+	}
+	if !strings.Contains(pattern, "/") {
+		return matchPath(pattern, path.Base(rel))
+	}
+	return matchPath(pattern, rel)
+}
+
+// ignoreRule is a line of a .gitignore file, base is the absolute directory of the file
+type ignoreRule struct {
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// readIgnoreRules reads the .gitignore file of the directory if any
+func readIgnoreRules(dir string) []ignoreRule {
+	file, err := os.Open(filepath.Join(dir, gitIgnoreFile))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	rules := []ignoreRule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// a pattern with a slash is relative to the directory of the .gitignore
+		if strings.Contains(line, "/") && !strings.HasPrefix(line, "**/") {
+			line = "/" + strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// parentIgnoreRules reads the .gitignore files of the parent directories of dir up to the root of its git repository
+func parentIgnoreRules(dir string) []ignoreRule {
+	dirs := []string{}
+	for parent := filepath.Dir(dir); ; parent = filepath.Dir(parent) {
+		dirs = append([]string{parent}, dirs...)
+		if _, err := os.Stat(filepath.Join(parent, ".git")); err == nil {
+			break
+		}
+		if parent == filepath.Dir(parent) {
+			// not in a git repository
+			return nil
+		}
+	}
+
+	rules := []ignoreRule{}
+	for _, parent := range dirs {
+		rules = append(rules, readIgnoreRules(parent)...)
+	}
+	return rules
+}
+
+// ignored returns true if the last rule matching the absolute file name ignores it
+func ignored(rules []ignoreRule, fileName string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, fileName)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if matchName(rule.pattern, filepath.ToSlash(rel)) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.yml", name: "x.yml", want: true},
+		{pattern: "*.yml", name: "a/x.yml", want: false},
+		{pattern: "a/*.yml", name: "a/x.yml", want: true},
+		{pattern: "a/*.yml", name: "a/b/x.yml", want: false},
+		{pattern: "**/x.yml", name: "x.yml", want: true},
+		{pattern: "**/x.yml", name: "a/b/x.yml", want: true},
+		{pattern: "a/**", name: "a/b/x.yml", want: true},
+		{pattern: "a/**", name: "b/x.yml", want: false},
+		{pattern: "a/**/x.yml", name: "a/x.yml", want: true},
+		{pattern: "a/**/x.yml", name: "a/b/c/x.yml", want: true},
+		{pattern: "a/**/x.yml", name: "b/c/x.yml", want: false},
+		{pattern: "vault.y?ml", name: "vault.yaml", want: true},
+		{pattern: "[ab].yml", name: "b.yml", want: true},
+		{pattern: "[ab].yml", name: "c.yml", want: false},
+		{pattern: "[", name: "[", want: false},
+		{pattern: "x.yml", name: "x.yml.bak", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchPath(%q, %q) : got %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{pattern: "*.vault", rel: "a/b/x.vault", want: true},
+		{pattern: "/x.yml", rel: "x.yml", want: true},
+		{pattern: "/x.yml", rel: "a/x.yml", want: false},
+		{pattern: "a/x.yml", rel: "a/x.yml", want: true},
+		{pattern: "a/x.yml", rel: "b/a/x.yml", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchName(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchName(%q, %q) : got %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-ignore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gitignore := "# comment\n\n*.bak\n!keep.bak\nbuild/\n/root.yml\nsub/only.yml\n**/deep.yml\ntrailing.yml  \n"
+	if err = ioutil.WriteFile(filepath.Join(dir, gitIgnoreFile), []byte(gitignore), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rules := readIgnoreRules(dir)
+	if len(rules) != 7 {
+		t.Fatalf("got %d rules, want 7", len(rules))
+	}
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{name: "x.bak", want: true},
+		{name: "a/x.bak", want: true},
+		{name: "keep.bak", want: false},
+		{name: "build", isDir: true, want: true},
+		{name: "build", want: false},
+		{name: "a/build", isDir: true, want: true},
+		{name: "root.yml", want: true},
+		{name: "a/root.yml", want: false},
+		{name: "sub/only.yml", want: true},
+		{name: "a/sub/only.yml", want: false},
+		{name: "a/b/deep.yml", want: true},
+		{name: "trailing.yml", want: true},
+		{name: "x.yml", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ignored(rules, filepath.Join(dir, filepath.FromSlash(tt.name)), tt.isDir); got != tt.want {
+			t.Errorf("%s : got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// rules don't apply outside of their directory
+	if ignored(rules, filepath.Join(filepath.Dir(dir), "x.bak"), false) {
+		t.Error("rule applied outside of its directory")
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+var wrapRecipients []string
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage vault keys",
+}
+
+// keyStoreCmd represents the key store command
+var keyStoreCmd = &cobra.Command{
+	Use:   "store source",
+	Short: "Save a key in the secret service or the password store",
+	Long: `Ask for a key and save it in the secret service, source keyring:service/account,
+	or in the password store of pass, source pass:name, encrypted with gpg for the keys of its .gpg-id
+	the source can then be used as a vault-id, --vault-id label@keyring:service/account
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		// a label@source vault-id is accepted
+		if idx := strings.Index(source, "@"); idx >= 0 && !vault.IsStoreSource(source) {
+			source = source[idx+1:]
+		}
+
+		key, err := readNewPassword(keyPrompt)
+		if err != nil {
+			return err
+		}
+
+		return vault.StoreKey(source, key)
+	},
+}
+
+// wrapKey encrypts the key given by the flags or asked for to the recipients
+func wrapKey(result *fileResult) error {
+	key, err := vault.GetKey(GetKeyFromFlags(), envKeyPrefix)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		if key, err = readNewPassword(keyPrompt); err != nil {
+			return err
+		}
+	}
+
+	wrapped, err := vault.WrapKey(key, wrapRecipients)
+	if err != nil {
+		return fmt.Errorf("key wrap : %w", err)
+	}
+
+	result.Status = statusEncrypted
+	if result.File == "-" {
+		return result.writeStdout(wrapped)
+	}
+
+	result.Output = result.File
+	return writeToFile(result.File, wrapped, vault.DefaultFileMode)
+}
+
+// keyWrapCmd represents the key wrap command
+var keyWrapCmd = &cobra.Command{
+	Use:   "wrap --recipient recipient...",
+	Short: "Encrypt a key file for age, ssh or OpenPGP public keys",
+	Long: `Encrypt the key given by --key, --key-file or --key-exec, or asked for, for every recipient
+	age1 and ssh public keys, or files holding them, are encrypted with age, other recipients are OpenPGP keys encrypted with gpg
+	the armored result is written to --output or stdout and can be committed and used as --key-file
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fileName := output
+		if fileName == "" {
+			fileName = "-"
+		}
+		return reportFile(fileName, wrapKey)
+	},
+}
+
+func init() {
+	keyWrapCmd.Flags().StringArrayVarP(&wrapRecipients, "recipient", "r", nil, "age or ssh public key, file of public keys or OpenPGP key id, can be repeated")
+	keyWrapCmd.MarkFlagRequired("recipient")
+
+	keyCmd.AddCommand(keyStoreCmd, keyWrapCmd)
+	rootCmd.AddCommand(keyCmd)
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	newVaultKeyExec, newVaultKeyFile, newVaultID string
+)
+
+// getNewIdentity returns the identity to rekey with from --new-vault-id, --new-key-exec or --new-key-file
+// or ask for it
+func getNewIdentity() (*vault.Identity, error) {
+	var (
+		keyChoice vault.Key
+		err       error
+	)
+
+	switch {
+	case newVaultID != "":
+		keyChoice, err = vault.ParseVaultID(newVaultID)
+		if err != nil {
+			return nil, err
+		}
+	case newVaultKeyExec != "":
+		keyChoice = vault.Key{Label: vault.DefaultLabel, Value: newVaultKeyExec, IsFile: true, IsExec: true}
+	case newVaultKeyFile != "":
+		keyChoice = vault.Key{Label: vault.DefaultLabel, Value: newVaultKeyFile, IsFile: true}
+	default:
+		keyChoice = vault.Key{Label: vault.DefaultLabel, IsPrompt: true}
+	}
+
+	var key string
+
+	if keyChoice.IsPrompt {
+		if doNotAskForKey {
+			return nil, fmt.Errorf("new key : %w", vault.ErrNoIdentity)
+		}
+		key, err = readNewPassword(keyPrompt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		key, err = vault.GetKey(keyChoice, envKeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("new key : %w", vault.ErrEmptyPassword)
+	}
+
+	return &vault.Identity{Label: keyChoice.Label, Password: key}, nil
+}
+
+// HasVault returns true if the content is a vault or a yaml file with inline vault entries
+func (i InputInfo) HasVault() bool {
+	if vault.MaybeEncryptedBytes(i.content) {
+		return true
+	}
+	if !i.IsYaml() {
+		return false
+	}
+	vaults, err := findYamlVaults(i.content)
+	if err != nil {
+		return bytes.Contains(i.content, []byte(yamlVaultTag))
+	}
+	return len(vaults) > 0
+}
+
+// rekeyFile decrypts the vaults of the file and encrypts them back with the new identity
+// the result status is skipped if the file doesn't hold any vault
+func rekeyFile(result *fileResult, identities vault.Identities, newID *vault.Identity) error {
+	inputInfo, err := GetInputInfo(result.File, identities, "")
+	if err != nil {
+		return err
+	}
+
+	if !inputInfo.HasVault() {
+		result.Status = statusSkipped
+		return nil
+	}
+
+	if err = inputInfo.Decrypt(true, keyPrompt); err != nil {
+		return err
+	}
+
+	inputInfo.encryptID = newID
+	inputInfo.forceEncrypt = true
+
+	encString, err := inputInfo.Encrypt()
+	if err != nil {
+		return fmt.Errorf("encrypt : %w", err)
+	}
+	if err = inputInfo.checkEncrypted(encString); err != nil {
+		return err
+	}
+
+	if err = writeToFile(result.File, encString, inputInfo.fileMode); err != nil {
+		return fmt.Errorf("saving encrypted file : %w", err)
+	}
+
+	result.Status = statusRekeyed
+	result.describe(encString, inputInfo.IsYaml())
+
+	return nil
+}
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [file or directory...]",
+	Short: "Encrypt vault files and inline yaml vaults with a new key",
+	Long: `Encrypt vault files and inline yaml !vault entries with a new key
+	files, directories and globs are given as arguments or with --input, directories are walked recursively
+	current key is provided as for decrypt, the new key with --new-vault-id, --new-key-exec or --new-key-file
+	or is asked for
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths := args
+		if len(paths) == 0 && input != "" && input != "-" {
+			paths = []string{input}
+		}
+		if len(paths) == 0 {
+			return errors.New("rekey : no file or directory given")
+		}
+
+		files, err := listFiles(paths)
+		if err != nil {
+			return err
+		}
+
+		identities, err := batchIdentities(false)
+		if err != nil {
+			return err
+		}
+
+		newID, err := getNewIdentity()
+		if err != nil {
+			return err
+		}
+
+		return runBatch("rekey", files, func(result *fileResult) error {
+			return rekeyFile(result, identities, newID)
+		})
+	},
+}
+
+func init() {
+	f := rekeyCmd.Flags()
+	f.StringVar(&newVaultID, "new-vault-id", "", "new vault identity as label@source where source is prompt, a file or an executable")
+	f.StringVar(&newVaultKeyExec, "new-key-exec", "", "new encryption key taken from an executable file")
+	f.StringVar(&newVaultKeyFile, "new-key-file", "", "new encryption key taken from a file")
+
+	addBatchFlags(rekeyCmd)
+
+	rootCmd.AddCommand(rekeyCmd)
+}
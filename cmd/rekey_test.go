@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+)
+
+// a whole-file vault whose plaintext holds inline vaults must stay a whole-file vault
+func TestRekeyWholeFileWithInlineVaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-rekey-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inline, err := vault.Encrypt("inner", "old", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := "---\nuser: admin\npassword: !vault |\n  " + strings.Replace(inline, "\n", "\n  ", -1) + "\n"
+
+	content, err := vault.Encrypt(plaintext, "old", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileName := filepath.Join(dir, "secrets.yml")
+	if err = ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := &fileResult{File: fileName}
+	err = rekeyFile(result, vault.Identities{{Label: vault.DefaultLabel, Password: "old"}}, &vault.Identity{Label: vault.DefaultLabel, Password: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rekeyed, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vault.MaybeEncryptedBytes(rekeyed) {
+		t.Fatalf("rekeyed file is not a whole-file vault:\n%s", rekeyed)
+	}
+
+	decrypted, err := vault.Decrypt(string(rekeyed), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != plaintext {
+		t.Errorf("got plaintext %q, want %q", decrypted, plaintext)
+	}
+}
+
+func TestCheckEncrypted(t *testing.T) {
+	i := &InputInfo{plaintext: []byte("user: admin\n"), wholeFile: true}
+	if err := i.checkEncrypted([]byte("user: admin\n")); err != ErrNotEncrypted {
+		t.Errorf("got %v, want %v", err, ErrNotEncrypted)
+	}
+	if err := i.checkEncrypted([]byte("$ANSIBLE_VAULT;1.1;AES256\n00\n")); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	// inline vaults of a plaintext yaml file are not checked
+	i = &InputInfo{}
+	if err := i.checkEncrypted([]byte("user: admin\n")); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
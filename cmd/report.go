@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// status of a file or of an inline vault in the json report
+const (
+	statusOK        = "ok"
+	statusError     = "error"
+	statusDecrypted = "decrypted"
+	statusEncrypted = "encrypted"
+	statusRekeyed   = "rekeyed"
+	statusUnchanged = "unchanged"
+	statusSkipped   = "skipped"
+)
+
+var outputFormat string
+
+// report is the json document written on stdout with --output-format json
+type report struct {
+	Status  string        `json:"status"`
+	Version string        `json:"version,omitempty"`
+	Error   *reportError  `json:"error,omitempty"`
+	Files   []*fileResult `json:"files"`
+	// number of files by status when several files are processed
+	Summary map[string]int `json:"summary,omitempty"`
+	Agent   *agentResult   `json:"agent,omitempty"`
+}
+
+type reportError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// fileResult is the result of a command on a file, file is - for stdin
+type fileResult struct {
+	File    string         `json:"file"`
+	Output  string         `json:"output,omitempty"`
+	Status  string         `json:"status"`
+	Version string         `json:"version,omitempty"`
+	Label   string         `json:"label,omitempty"`
+	Entries []*entryResult `json:"entries,omitempty"`
+	Error   *reportError   `json:"error,omitempty"`
+	// problems found by check
+	Problems []*problem `json:"problems,omitempty"`
+	// output written to stdout, base64 encoded when it isn't utf-8
+	Content       *string `json:"content,omitempty"`
+	ContentBase64 *string `json:"content_base64,omitempty"`
+}
+
+// entryResult is an inline yaml vault, path is the key path of the entry
+type entryResult struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Version string `json:"version"`
+	Label   string `json:"label"`
+}
+
+var results = &report{Files: []*fileResult{}}
+
+func jsonOutput() bool {
+	return outputFormat == outputFormatJSON
+}
+
+func checkOutputFormat() error {
+	switch outputFormat {
+	case outputFormatText, outputFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("--output-format %s : must be %s or %s", outputFormat, outputFormatText, outputFormatJSON)
+}
+
+func newReportError(err error) *reportError {
+	return &reportError{Code: exitCode(err), Message: err.Error()}
+}
+
+// newFileResult adds the result of a file to the report
+func newFileResult(fileName string) *fileResult {
+	if fileName == "" {
+		fileName = "-"
+	}
+	result := &fileResult{File: fileName, Status: statusOK}
+	results.Files = append(results.Files, result)
+	return result
+}
+
+// reportFile runs fn on the file and records its error in the result
+func reportFile(fileName string, fn func(result *fileResult) error) error {
+	result := newFileResult(fileName)
+	err := fn(result)
+	if err != nil {
+		result.fail(err)
+	}
+	return err
+}
+
+func (r *fileResult) fail(err error) {
+	r.Status = statusError
+	r.Error = newReportError(err)
+}
+
+// describe sets the vault version and label of a vault file or the inline vaults of a yaml file
+func (r *fileResult) describe(content []byte, isYaml bool) {
+	if vault.MaybeEncryptedBytes(content) {
+		r.Version, r.Label = headerInfo(content)
+		return
+	}
+	if !isYaml {
+		return
+	}
+
+	vaults, err := findYamlVaults(content)
+	if err != nil {
+		return
+	}
+	for _, v := range vaults {
+		if !v.IsEncrypted() {
+			continue
+		}
+		version, label := headerInfo([]byte(v.vaultText()))
+		r.Entries = append(r.Entries, &entryResult{Path: v.path, Line: v.line, Version: version, Label: label})
+	}
+}
+
+// headerInfo returns the version and the vault-id label of a vault
+func headerInfo(content []byte) (string, string) {
+	if idx := bytes.IndexByte(content, '\n'); idx >= 0 {
+		content = content[:idx]
+	}
+	header, err := vault.ParseHeader(string(content))
+	if err != nil {
+		return "", ""
+	}
+	if !header.HasLabel() {
+		return header.Version, vault.DefaultLabel
+	}
+	return header.Version, header.Label
+}
+
+// writeStdout writes the output of a command, it goes into the report with --output-format json
+func (r *fileResult) writeStdout(content []byte) error {
+	if !jsonOutput() {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	if utf8.Valid(content) {
+		text := string(content)
+		r.Content = &text
+	} else {
+		text := base64.StdEncoding.EncodeToString(content)
+		r.ContentBase64 = &text
+	}
+	return nil
+}
+
+// writeReport writes the json report with the error of the command if any
+func writeReport(err error) {
+	results.Status = statusOK
+	if err != nil {
+		results.Status = statusError
+		results.Error = newReportError(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(results)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 
@@ -10,14 +11,13 @@ import (
 
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh/terminal"
-
-	homedir "github.com/mitchellh/go-homedir"
-	"github.com/spf13/viper"
 )
 
 var (
 	version, envKeyPrefix, cfgFile, input, output, vaultKeyExec, vaultKeyFile, vaultKey, keyPrompt string
-	doNotAskForKey                                                                                 bool
+	encryptVaultID                                                                                 string
+	vaultIDs, keyIdentities                                                                        []string
+	doNotAskForKey, keyRaw                                                                         bool
 )
 
 func GetKeyFromFlags() vault.Key {
@@ -47,12 +47,65 @@ func GetKeyFromFlags() vault.Key {
 	}
 }
 
+// GetKeysFromFlags returns the key given by --key-exec, --key-file or --key followed by every --vault-id
+func GetKeysFromFlags() ([]vault.Key, error) {
+	keys := []vault.Key{GetKeyFromFlags()}
+
+	for _, vaultID := range vaultIDs {
+		key, err := vault.ParseVaultID(vaultID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// GetIdentitiesFromFlags resolves the keys given on the cli into vault identities
+// keys with a prompt source are asked for, unresolved keys are skipped
+func GetIdentitiesFromFlags() (vault.Identities, error) {
+	keys, err := GetKeysFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	identities := vault.Identities{}
+
+	for _, keyChoice := range keys {
+		// the cli/env key is only looked up when no vault-id is given
+		if keyChoice.Label == "" && keyChoice.Value == "" && len(keys) > 1 {
+			continue
+		}
+
+		label := keyChoice.Label
+		if label == "" {
+			label = vault.DefaultLabel
+		}
+
+		// a prompt is only shown when the agent doesn't hold the key
+		key, alternate, err := vault.GetKeyWithAlternate(keyChoice, envKeyPrefix)
+		if err == nil && key == "" && keyChoice.IsPrompt {
+			key, err = readPassword(fmt.Sprintf("Enter key for vault-id %s", label), keyPrompt)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "" {
+			identities = append(identities, vault.Identity{Label: label, Password: key, Alternate: alternate})
+		}
+	}
+
+	return identities, nil
+}
+
 func readPassword(label string, keyPrompt string) (string, error) {
 	fd := int(os.Stdin.Fd())
 
 	oldState, err := terminal.GetState(fd)
 	if err != nil {
-		return "", fmt.Errorf("could not get state of terminal : %w", err)
+		return "", fmt.Errorf("%s : %w", label, ErrNoTerminal)
 	}
 
 	defer cleanup.Trap(
@@ -68,16 +121,39 @@ func readPassword(label string, keyPrompt string) (string, error) {
 	fmt.Fprintf(os.Stderr, "%s %s: ", label, keyPrompt)
 	tmp, err := terminal.ReadPassword(fd)
 	fmt.Fprint(os.Stderr, "\n")
+	// ctrl-d
+	if err == io.EOF {
+		return "", fmt.Errorf("%s : %w", label, ErrAborted)
+	}
 	if err != nil {
 		return "", fmt.Errorf("%s : %w", label, err)
 	}
 	return string(tmp), nil
 }
 
-func writeToFile(fileName string, content string, mode os.FileMode) error {
+// readNewPassword asks for a new key twice
+func readNewPassword(keyPrompt string) (string, error) {
+	key, err := readPassword("Enter new key", keyPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	key2, err := readPassword("Confirm new key", keyPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	if key != key2 {
+		return "", fmt.Errorf("error password differs")
+	}
+
+	return key, nil
+}
+
+func writeToFile(fileName string, content []byte, mode os.FileMode) error {
 	tmpName := fileName + ".tmp"
 
-	err := ioutil.WriteFile(tmpName, ([]byte)(content), mode)
+	err := ioutil.WriteFile(tmpName, content, mode)
 	if err != nil {
 		return err
 	}
@@ -91,52 +167,53 @@ var rootCmd = &cobra.Command{
 	Use:   "avh",
 	Short: "Ansible Vault Helper",
 	Long:  `Helper to edit/encrypt/decrypt ansible vault file`,
+	// errors are printed on one line by Execute
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd, args); err != nil {
+			return err
+		}
+		if err := loadAnsibleConfig(); err != nil {
+			return err
+		}
+		vault.KeyIdentities = keyIdentities
+		vault.RawKeys = keyRaw
+		// the json report would corrupt the content git reads on stdout
+		if _, ok := cmd.Annotations[gitDriverAnnotation]; ok {
+			outputFormat = outputFormatText
+		}
+		return checkOutputFormat()
+	},
 	// Run: func(cmd *cobra.Command, args []string) {
 	// },
 }
 
 func Execute(v string) {
 	version = v
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := rootCmd.Execute()
+	if jsonOutput() {
+		writeReport(err)
+	}
+	if err != nil {
+		exit(err)
 	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	pf := rootCmd.PersistentFlags()
-	//	pf.StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.avh.yaml)")
+	pf.StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.avh.yaml merged with the .avh.yaml files of the current directory and its parents)")
 	pf.StringVarP(&envKeyPrefix, "env-key-prefix", "e", "DEFAULT", "prefix to be add in front of env var _VAULT_PASSWORD_EXEC or _VAULT_PASSWORD_FILE")
 	pf.StringVarP(&input, "input", "i", "", "input file to edit or - to edit from stdin")
 	pf.StringVarP(&output, "output", "o", "", "output file to save or - to print to stdout")
 	pf.StringVarP(&vaultKey, "key", "k", "", "raw encryption/decryption key")
 	pf.StringVar(&vaultKeyExec, "key-exec", "", "encryption/decryption key taken from an executable file")
 	pf.StringVar(&vaultKeyFile, "key-file", "", "encryption/decryption key taken from a file to encrypt/decrypt data")
+	pf.StringArrayVar(&vaultIDs, "vault-id", nil, "vault identity as label@source where source is prompt, keyring:service/account, pass:name, a file or an executable, can be repeated")
+	pf.StringVar(&encryptVaultID, "encrypt-vault-id", "", "label of the vault-id to use for encryption")
+	pf.BoolVar(&keyRaw, "key-raw", false, "use key files and executable output as is, ansible strips the whitespace around them")
+	pf.StringArrayVar(&keyIdentities, "key-identity", nil, "age identity file or ssh private key decrypting age key files, can be repeated (default ~/.ssh/id_ed25519 and ~/.ssh/id_rsa)")
 	pf.BoolVarP(&doNotAskForKey, "do-not-ask-for-key", "d", false, "even if key is not found do not ask for it")
 	pf.StringVarP(&keyPrompt, "key-prompt", "p", "", "key prompt to show when asking for key")
-
-}
-
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".avh")
-	}
-
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
-	}
+	pf.StringVar(&outputFormat, "output-format", outputFormatText, "output format, text or json to print a json report on stdout")
 }
@@ -12,6 +12,10 @@ var versionCmd = &cobra.Command{
 	Short: "show avh version",
 	Long:  `show avh version`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if jsonOutput() {
+			results.Version = version
+			return
+		}
 		fmt.Printf("v%s", version)
 	},
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func getPager() []string {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		return []string{defaultPager}
+	}
+	return pager
+}
+
+// page pipes the content into the pager, or prints it when stdout isn't a terminal
+func page(content []byte) error {
+	if !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	pager := getPager()
+
+	executable, err := exec.LookPath(pager[0])
+	if err != nil {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+
+	cmd := exec.Command(executable, pager[1:]...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// quit if one screen, keep colors and don't clear the screen as ansible-vault does
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+
+	return cmd.Run()
+}
+
+// viewCmd represents the view command
+var viewCmd = &cobra.Command{
+	Use:   "view [file]",
+	Short: "View a vault file or the inline vaults of a yaml file",
+	Long: `View a vault file or the inline vaults of a yaml file without writing anything on disk
+	decrypted content is shown with the pager set in env variable PAGER or printed if stdout isn't a terminal
+	encryption/decryption key can be provided with the --key flag
+	or into [env-key-prefix]_VAULT_PASSWORD_EXEC env var, if it's a file and executable , ot will be executed to get the key
+	or into [env-key-prefix]_VAULT_PASSWORD_FILE env var, if it'snt a file then it's taken as the key
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			input = args[0]
+		}
+
+		return reportFile(input, viewFile)
+	},
+}
+
+// viewFile shows --input decrypted with the pager
+func viewFile(result *fileResult) error {
+	identities, err := GetIdentitiesFromFlags()
+	if err != nil {
+		return err
+	}
+
+	inputInfo, err := GetInputInfo(input, identities, "")
+	if err != nil {
+		return err
+	}
+
+	if inputInfo.isFile && inputInfo.content == nil {
+		return fmt.Errorf("view : %s : %w", input, os.ErrNotExist)
+	}
+
+	result.Status = statusUnchanged
+	if inputInfo.HasVault() {
+		if len(inputInfo.identities) == 0 && !doNotAskForKey {
+			key, err := readPassword("Enter key", keyPrompt)
+			if err != nil {
+				return err
+			}
+			inputInfo.identities = append(inputInfo.identities, vault.Identity{Label: vault.DefaultLabel, Password: key})
+		}
+
+		result.describe(inputInfo.content, inputInfo.IsYaml())
+
+		if err = inputInfo.Decrypt(true, keyPrompt); err != nil {
+			return err
+		}
+		result.Status = statusDecrypted
+	}
+
+	if jsonOutput() {
+		return result.writeStdout(inputInfo.content)
+	}
+	return page(inputInfo.content)
+}
+
+func init() {
+	rootCmd.AddCommand(viewCmd)
+}
@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pleclech/ansible-vault-helper/vault"
+
+	"gopkg.in/yaml.v3"
+)
+
+const yamlVaultTag = "!vault"
+
+// yamlIndent is the indentation of inline vaults below their key, it can be set in the config
+var yamlIndent = 2
+
+// yamlVault is a !vault tagged scalar found in a yaml content
+type yamlVault struct {
+	path    string
+	line    int
+	value   string
+	start   int
+	end     int
+	indent  int
+	flow    bool
+	comment string
+}
+
+// yamlReplacement replaces content[start:end] with text
+type yamlReplacement struct {
+	start, end int
+	text       string
+}
+
+type yamlFinder struct {
+	content []byte
+	lines   []int
+	vaults  []*yamlVault
+}
+
+// findYamlVaults returns every !vault scalar of every document of the yaml content in order
+func findYamlVaults(content []byte) ([]*yamlVault, error) {
+	f := &yamlFinder{content: content, lines: []int{0}}
+	for i, c := range content {
+		if c == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yaml : %w", err)
+		}
+		if err = f.walk(&doc, "", -yamlIndent, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.vaults, nil
+}
+
+func (f *yamlFinder) walk(node *yaml.Node, path string, ownerIndent int, flow bool) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := f.walk(child, path, ownerIndent, flow); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		flow = flow || node.Style&yaml.FlowStyle != 0
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			if err := f.walk(node.Content[i+1], childPath, key.Column-1, flow); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		flow = flow || node.Style&yaml.FlowStyle != 0
+		for i, child := range node.Content {
+			if err := f.walk(child, fmt.Sprintf("%s[%d]", path, i), node.Column-1, flow); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag != yamlVaultTag {
+			return nil
+		}
+		v, err := f.locate(node, ownerIndent, flow)
+		if err != nil {
+			return err
+		}
+		v.path = path
+		f.vaults = append(f.vaults, v)
+	}
+	return nil
+}
+
+// offset converts a 1 based line and column into a byte offset of the content
+func (f *yamlFinder) offset(line, column int) int {
+	if line < 1 || line > len(f.lines) {
+		return len(f.content)
+	}
+	offset := f.lines[line-1]
+	for column > 1 && offset < len(f.content) && f.content[offset] != '\n' {
+		_, size := utf8.DecodeRune(f.content[offset:])
+		offset += size
+		column--
+	}
+	return offset
+}
+
+// lineEnd returns the offset of the end of the line holding offset, newline excluded
+func (f *yamlFinder) lineEnd(offset int) int {
+	if idx := bytes.IndexByte(f.content[offset:], '\n'); idx >= 0 {
+		return offset + idx
+	}
+	return len(f.content)
+}
+
+// locate finds the span of the tagged scalar in the content
+func (f *yamlFinder) locate(node *yaml.Node, ownerIndent int, flow bool) (*yamlVault, error) {
+	v := &yamlVault{
+		line:   node.Line,
+		value:  node.Value,
+		indent: ownerIndent + yamlIndent,
+		flow:   flow,
+	}
+
+	// the node position can be the one of an anchor preceding the tag
+	from := f.offset(node.Line, node.Column)
+	idx := bytes.Index(f.content[from:], []byte(yamlVaultTag))
+	if idx < 0 {
+		return nil, fmt.Errorf("yaml : line %d : %s tag not found", node.Line, yamlVaultTag)
+	}
+	v.start = from + idx
+	pos := v.start + len(yamlVaultTag)
+
+	var err error
+	switch {
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		err = f.locateBlock(v, pos, ownerIndent)
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		err = f.locateQuoted(v, pos, '"')
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		err = f.locateQuoted(v, pos, '\'')
+	default:
+		err = f.locatePlain(v, pos)
+	}
+	return v, err
+}
+
+func (f *yamlFinder) locateBlock(v *yamlVault, pos int, ownerIndent int) error {
+	headerEnd := f.lineEnd(pos)
+	header := string(f.content[pos:headerEnd])
+
+	contentIndent := -1
+	if idx := strings.Index(header, "#"); idx >= 0 {
+		v.comment = strings.TrimSpace(header[idx:])
+		header = header[:idx]
+	}
+	for _, c := range strings.TrimSpace(header) {
+		if c >= '1' && c <= '9' {
+			contentIndent = ownerIndent + int(c-'0')
+		}
+	}
+
+	v.end = headerEnd
+	for offset := headerEnd + 1; offset < len(f.content); {
+		end := f.lineEnd(offset)
+		line := f.content[offset:end]
+		trimmed := bytes.TrimLeft(line, " ")
+		offset = end + 1
+
+		if len(bytes.TrimSpace(trimmed)) == 0 {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+		if contentIndent < 0 {
+			if indent <= ownerIndent {
+				break
+			}
+			contentIndent = indent
+		}
+		if indent < contentIndent {
+			break
+		}
+		v.end = end
+	}
+
+	return nil
+}
+
+func (f *yamlFinder) locateQuoted(v *yamlVault, pos int, quote byte) error {
+	idx := bytes.IndexByte(f.content[pos:], quote)
+	if idx < 0 {
+		return fmt.Errorf("yaml : line %d : unterminated quoted %s", v.line, yamlVaultTag)
+	}
+
+	for i := pos + idx + 1; i < len(f.content); i++ {
+		switch c := f.content[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote && quote == '\'' && i+1 < len(f.content) && f.content[i+1] == '\'':
+			i++
+		case c == quote:
+			v.end = i + 1
+			return nil
+		}
+	}
+
+	return fmt.Errorf("yaml : line %d : unterminated quoted %s", v.line, yamlVaultTag)
+}
+
+func (f *yamlFinder) locatePlain(v *yamlVault, pos int) error {
+	v.end = pos
+	for _, field := range strings.Fields(v.value) {
+		idx := bytes.Index(f.content[v.end:], []byte(field))
+		if idx < 0 {
+			return fmt.Errorf("yaml : line %d : plain %s not found", v.line, yamlVaultTag)
+		}
+		v.end += idx + len(field)
+	}
+	return nil
+}
+
+// vaultText returns the value as a vault envelope, folded or flow values have their lines joined by spaces
+func (v yamlVault) vaultText() string {
+	return strings.Join(strings.Fields(v.value), "\n")
+}
+
+// IsEncrypted returns true if the value holds a vault envelope
+func (v yamlVault) IsEncrypted() bool {
+	return vault.MaybeEncrypted(v.vaultText())
+}
+
+// render returns the tagged scalar holding text, a literal block in block context or a quoted string in flow context
+func (v yamlVault) render(text string) string {
+	if v.flow {
+		return yamlVaultTag + " " + strconv.Quote(text)
+	}
+
+	body := strings.TrimRight(text, "\n")
+
+	indicator := "|"
+	switch len(text) - len(body) {
+	case 0:
+		indicator += "-"
+	case 1:
+	default:
+		indicator += "+"
+		body = text[:len(text)-1]
+	}
+
+	// leading spaces can't be told from indentation without an indentation indicator
+	if strings.HasPrefix(body, " ") || strings.HasPrefix(body, "\n") {
+		indicator = "|" + strconv.Itoa(yamlIndent) + indicator[1:]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(yamlVaultTag)
+	sb.WriteString(" ")
+	sb.WriteString(indicator)
+	if v.comment != "" {
+		sb.WriteString(" ")
+		sb.WriteString(v.comment)
+	}
+
+	if body == "" && indicator == "|-" {
+		return sb.String()
+	}
+
+	sep := strings.Repeat(" ", v.indent)
+	for _, line := range strings.Split(body, "\n") {
+		sb.WriteString("\n")
+		if line != "" {
+			sb.WriteString(sep)
+			sb.WriteString(line)
+		}
+	}
+
+	return sb.String()
+}
+
+// applyYamlReplacements returns the content with every replacement applied
+func applyYamlReplacements(content []byte, replacements []yamlReplacement) []byte {
+	sort.Slice(replacements, func(a, b int) bool {
+		return replacements[a].start > replacements[b].start
+	})
+
+	result := append([]byte{}, content...)
+	for _, r := range replacements {
+		tail := append([]byte(r.text), result[r.end:]...)
+		result = append(result[:r.start], tail...)
+	}
+
+	return result
+}
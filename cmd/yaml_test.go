@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestFindYamlVaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		paths   []string
+		values  []string
+		texts   []string
+	}{
+		{
+			name:    "block",
+			content: "a: 1\nsecret: !vault |\n  line1\n  line2\nb: 2\n",
+			paths:   []string{"secret"},
+			values:  []string{"line1\nline2\n"},
+			texts:   []string{"!vault |\n  line1\n  line2"},
+		},
+		{
+			name:    "block with comment and strip indicator",
+			content: "secret: !vault |- # keep\n    x\n",
+			paths:   []string{"secret"},
+			values:  []string{"x"},
+			texts:   []string{"!vault |- # keep\n    x"},
+		},
+		{
+			name:    "nested block followed by a sibling",
+			content: "db:\n  password: !vault |\n    x\n  user: admin\n",
+			paths:   []string{"db.password"},
+			values:  []string{"x\n"},
+			texts:   []string{"!vault |\n    x"},
+		},
+		{
+			name:    "double quoted",
+			content: "secret: !vault \"a\\nb\"\n",
+			paths:   []string{"secret"},
+			values:  []string{"a\nb"},
+			texts:   []string{"!vault \"a\\nb\""},
+		},
+		{
+			name:    "single quoted",
+			content: "secret: !vault 'it''s'\n",
+			paths:   []string{"secret"},
+			values:  []string{"it's"},
+			texts:   []string{"!vault 'it''s'"},
+		},
+		{
+			name:    "plain",
+			content: "secret: !vault abc def\nnext: 1\n",
+			paths:   []string{"secret"},
+			values:  []string{"abc def"},
+			texts:   []string{"!vault abc def"},
+		},
+		{
+			name:    "flow mapping and sequence",
+			content: "m: {a: !vault x, b: 1}\nl:\n  - !vault y\n",
+			paths:   []string{"m.a", "l[0]"},
+			values:  []string{"x", "y"},
+			texts:   []string{"!vault x", "!vault y"},
+		},
+		{
+			name:    "documents",
+			content: "a: !vault x\n---\nb: !vault y\n",
+			paths:   []string{"a", "b"},
+			values:  []string{"x", "y"},
+			texts:   []string{"!vault x", "!vault y"},
+		},
+		{
+			name:    "anchor before the tag",
+			content: "a: &ref !vault x\nb: *ref\n",
+			paths:   []string{"a"},
+			values:  []string{"x"},
+			texts:   []string{"!vault x"},
+		},
+		{
+			name:    "no vault",
+			content: "a: 1\nb: \"!vault\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaults, err := findYamlVaults([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vaults) != len(tt.paths) {
+				t.Fatalf("got %d vaults, want %d", len(vaults), len(tt.paths))
+			}
+			for i, v := range vaults {
+				if v.path != tt.paths[i] {
+					t.Errorf("vault %d : got path %q, want %q", i, v.path, tt.paths[i])
+				}
+				if v.value != tt.values[i] {
+					t.Errorf("vault %d : got value %q, want %q", i, v.value, tt.values[i])
+				}
+				if text := tt.content[v.start:v.end]; text != tt.texts[i] {
+					t.Errorf("vault %d : got text %q, want %q", i, text, tt.texts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFindYamlVaultsInvalid(t *testing.T) {
+	if _, err := findYamlVaults([]byte("a: [\n")); err == nil {
+		t.Error("invalid yaml : got no error")
+	}
+}
+
+// a rendered vault must be found back with the same value, in block and flow context
+func TestYamlVaultRenderRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"x",
+		"x\n",
+		"x\n\n",
+		"line1\nline2",
+		"line1\n\nline2\n",
+		"  leading spaces",
+		"\nleading newline",
+		"# not a comment",
+		"quotes ' and \"",
+		"tab\tand unicode é",
+	}
+
+	layouts := []struct {
+		name   string
+		prefix string
+		suffix string
+		flow   bool
+		indent int
+	}{
+		{name: "top level", prefix: "secret: ", suffix: "\nnext: 1\n", indent: yamlIndent},
+		{name: "nested", prefix: "db:\n  secret: ", suffix: "\n  next: 1\n", indent: 2 + yamlIndent},
+		{name: "flow", prefix: "m: {secret: ", suffix: ", next: 1}\n", flow: true},
+	}
+
+	for _, layout := range layouts {
+		for _, value := range values {
+			v := yamlVault{indent: layout.indent, flow: layout.flow}
+			content := layout.prefix + v.render(value) + layout.suffix
+
+			vaults, err := findYamlVaults([]byte(content))
+			if err != nil {
+				t.Errorf("%s %q : %v\n%s", layout.name, value, err, content)
+				continue
+			}
+			if len(vaults) != 1 {
+				t.Errorf("%s %q : got %d vaults\n%s", layout.name, value, len(vaults), content)
+				continue
+			}
+			if vaults[0].value != value {
+				t.Errorf("%s %q : got value %q\n%s", layout.name, value, vaults[0].value, content)
+			}
+		}
+	}
+}
+
+func TestApplyYamlReplacements(t *testing.T) {
+	content := []byte("a: 1\nb: 2\nc: 3\n")
+	result := applyYamlReplacements(content, []yamlReplacement{
+		{start: 3, end: 4, text: "one"},
+		{start: 13, end: 14, text: "three"},
+	})
+	if got, want := string(result), "a: one\nb: 2\nc: three\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if string(content) != "a: 1\nb: 2\nc: 3\n" {
+		t.Errorf("content modified : %q", content)
+	}
+}
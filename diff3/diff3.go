@@ -0,0 +1,209 @@
+package diff3
+
+import (
+	"bytes"
+	"strings"
+)
+
+const markerSize = 7
+
+// Labels are the names written after the conflict markers
+type Labels struct {
+	Ours   string
+	Theirs string
+}
+
+// Merge merges ours and theirs changes from base line by line
+// conflicting hunks are written between conflict markers and counted
+func Merge(base, ours, theirs []byte, labels Labels) ([]byte, int) {
+	o := splitLines(base)
+	a := splitLines(ours)
+	b := splitLines(theirs)
+
+	matchA := matches(o, a)
+	matchB := matches(o, b)
+
+	var result bytes.Buffer
+	conflicts := 0
+
+	i, j, k := 0, 0, 0
+	for {
+		// next base line kept by both sides
+		m := i
+		for m < len(o) && (matchA[m] < 0 || matchB[m] < 0) {
+			m++
+		}
+
+		endA, endB := len(a), len(b)
+		if m < len(o) {
+			endA, endB = matchA[m], matchB[m]
+		}
+
+		if m == i && endA == j && endB == k {
+			if m == len(o) {
+				break
+			}
+			result.WriteString(o[m])
+			i, j, k = m+1, j+1, k+1
+			continue
+		}
+
+		if !mergeHunk(&result, o[i:m], a[j:endA], b[k:endB], labels) {
+			conflicts++
+		}
+
+		i, j, k = m, endA, endB
+	}
+
+	return result.Bytes(), conflicts
+}
+
+// mergeHunk writes the merged hunk, it returns false if both sides changed it differently
+func mergeHunk(result *bytes.Buffer, o, a, b []string, labels Labels) bool {
+	switch {
+	case equalLines(a, o):
+		writeLines(result, b)
+	case equalLines(b, o), equalLines(a, b):
+		writeLines(result, a)
+	default:
+		writeMarker(result, "<", labels.Ours)
+		writeLines(result, ensureNewline(a))
+		writeMarker(result, "=", "")
+		writeLines(result, ensureNewline(b))
+		writeMarker(result, ">", labels.Theirs)
+		return false
+	}
+	return true
+}
+
+func writeMarker(result *bytes.Buffer, marker string, label string) {
+	result.WriteString(strings.Repeat(marker, markerSize))
+	if label != "" {
+		result.WriteString(" ")
+		result.WriteString(label)
+	}
+	result.WriteString("\n")
+}
+
+func writeLines(result *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		result.WriteString(line)
+	}
+}
+
+// ensureNewline terminates the last line so a marker can follow it
+func ensureNewline(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	result := append([]string{}, lines...)
+	result[len(result)-1] += "\n"
+	return result
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines splits the content after each newline, line endings are kept
+func splitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		idx := bytes.IndexByte(content, '\n')
+		if idx < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:idx+1]))
+		content = content[idx+1:]
+	}
+	return lines
+}
+
+// matches returns for every line of a the index of the matching line of b in a longest common subsequence, or -1
+func matches(a, b []string) []int {
+	result := make([]int, len(a))
+	for i := range result {
+		result[i] = -1
+	}
+
+	for _, match := range lcs(a, b) {
+		result[match[0]] = match[1]
+	}
+
+	return result
+}
+
+// lcs returns the pairs of matching lines of a longest common subsequence using Myers' algorithm
+func lcs(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	pairs := [][2]int{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			pairs = append(pairs, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		pairs = append(pairs, [2]int{x, y})
+	}
+
+	for l, r := 0, len(pairs)-1; l < r; l, r = l+1, r-1 {
+		pairs[l], pairs[r] = pairs[r], pairs[l]
+	}
+
+	return pairs
+}
@@ -0,0 +1,147 @@
+package diff3
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	labels := Labels{Ours: "ours", Theirs: "theirs"}
+
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		want      string
+		conflicts int
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "ours only",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nB\nc\n",
+		},
+		{
+			name:   "theirs only",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nC\n",
+			want:   "a\nb\nC\n",
+		},
+		{
+			name:   "both sides on different lines",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:   "same change on both sides",
+			base:   "a\nb\nc\n",
+			ours:   "a\nX\nc\n",
+			theirs: "a\nX\nc\n",
+			want:   "a\nX\nc\n",
+		},
+		{
+			name:   "insertions and deletions",
+			base:   "a\nb\nc\nd\n",
+			ours:   "a\nnew\nb\nc\nd\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nnew\nb\nc\n",
+		},
+		{
+			name:      "conflict",
+			base:      "a\nb\nc\n",
+			ours:      "a\nours\nc\n",
+			theirs:    "a\ntheirs\nc\n",
+			want:      "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "conflict without final newline",
+			base:      "a\nb",
+			ours:      "a\nours",
+			theirs:    "a\ntheirs",
+			want:      "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+		{
+			name:      "two conflicts",
+			base:      "a\nb\nc\nd\ne\n",
+			ours:      "1\nb\nc\nd\n2\n",
+			theirs:    "x\nb\nc\nd\ny\n",
+			want:      "<<<<<<< ours\n1\n=======\nx\n>>>>>>> theirs\nb\nc\nd\n<<<<<<< ours\n2\n=======\ny\n>>>>>>> theirs\n",
+			conflicts: 2,
+		},
+		{
+			name:   "empty base",
+			base:   "",
+			ours:   "a\n",
+			theirs: "",
+			want:   "a\n",
+		},
+		{
+			name:      "both added to empty base",
+			base:      "",
+			ours:      "a\n",
+			theirs:    "b\n",
+			want:      "<<<<<<< ours\na\n=======\nb\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+		{
+			name:   "crlf lines are kept",
+			base:   "a\r\nb\r\n",
+			ours:   "a\r\nB\r\n",
+			theirs: "a\r\nb\r\n",
+			want:   "a\r\nB\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), labels)
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if conflicts != tt.conflicts {
+				t.Errorf("got %d conflicts, want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestLcs(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want int
+	}{
+		{a: []string{}, b: []string{}, want: 0},
+		{a: []string{"a"}, b: []string{}, want: 0},
+		{a: []string{"a", "b", "c"}, b: []string{"a", "b", "c"}, want: 3},
+		{a: []string{"a", "b", "c", "a", "b", "b", "a"}, b: []string{"c", "b", "a", "b", "a", "c"}, want: 4},
+		{a: []string{"x", "y"}, b: []string{"y", "x"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		pairs := lcs(tt.a, tt.b)
+		if len(pairs) != tt.want {
+			t.Errorf("lcs(%q, %q) : got %d pairs, want %d", tt.a, tt.b, len(pairs), tt.want)
+		}
+		for i, p := range pairs {
+			if tt.a[p[0]] != tt.b[p[1]] {
+				t.Errorf("lcs(%q, %q) : pair %v doesn't match", tt.a, tt.b, p)
+			}
+			if i > 0 && (p[0] <= pairs[i-1][0] || p[1] <= pairs[i-1][1]) {
+				t.Errorf("lcs(%q, %q) : pairs out of order %v", tt.a, tt.b, pairs)
+			}
+		}
+	}
+}
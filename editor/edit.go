@@ -50,19 +50,22 @@ func OpenFileInEditor(filename string, resolveEditor PreferredEditorResolver) er
 // CaptureInputFromEditor opens a temporary file in a text editor and returns
 // the written bytes on success or an error on failure. It handles deletion
 // of the temporary file behind the scenes.
-func CaptureInputFromEditor(resolveEditor PreferredEditorResolver, initialContent []byte, fileExt string) ([]byte, error) {
-	file, err := ioutil.TempFile(os.TempDir(), "*"+fileExt)
+// The file is created in a private directory of a RAM backed file system
+// unless allowDisk is true and none is available, its content is wiped before removal.
+func CaptureInputFromEditor(resolveEditor PreferredEditorResolver, initialContent []byte, fileExt string, allowDisk bool) ([]byte, error) {
+	file, dir, err := createPrivateFile(allowDisk, fileExt)
 	if err != nil {
 		return []byte{}, err
 	}
 
 	filename := file.Name()
 
-	// Defer removal of the temporary file in case any of the next steps fail.
-	defer cleanup.Trap(func() { os.Remove(filename) })()
+	// Defer wiping of the temporary directory in case any of the next steps fail.
+	defer cleanup.Trap(func() { wipeDir(dir) })()
 
 	if len(initialContent) != 0 {
 		if _, err = file.Write(initialContent); err != nil {
+			file.Close()
 			return []byte{}, err
 		}
 	}
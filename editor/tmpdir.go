@@ -0,0 +1,98 @@
+package editor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	privateDirMode  = 0700
+	privateFileMode = 0600
+)
+
+// ErrNoSecureTempDir is returned when no RAM backed directory is available for plaintext
+var ErrNoSecureTempDir = errors.New("no RAM backed temporary directory found")
+
+// secureTempDirCandidates returns the directories that may be RAM backed in order of preference
+func secureTempDirCandidates() []string {
+	dirs := []string{}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	return append(dirs, "/dev/shm")
+}
+
+// secureTempBaseDir returns a RAM backed directory, or the default temporary directory if allowDisk is true
+func secureTempBaseDir(allowDisk bool) (string, error) {
+	for _, dir := range secureTempDirCandidates() {
+		if stat, err := os.Stat(dir); err == nil && stat.IsDir() && isRAMBacked(dir) {
+			return dir, nil
+		}
+	}
+	if allowDisk {
+		return os.TempDir(), nil
+	}
+	return "", ErrNoSecureTempDir
+}
+
+// wipeFile overwrites the content of the file with zeros before removing it
+func wipeFile(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY, 0)
+	if err == nil {
+		if stat, err := file.Stat(); err == nil {
+			zeros := make([]byte, 4096)
+			for remaining := stat.Size(); remaining > 0; {
+				n := int64(len(zeros))
+				if remaining < n {
+					n = remaining
+				}
+				if _, err = file.Write(zeros[:n]); err != nil {
+					break
+				}
+				remaining -= n
+			}
+			file.Sync()
+		}
+		file.Close()
+	}
+	return os.Remove(fileName)
+}
+
+// wipeDir wipes every file of the directory, editor swap and backup files included, then removes it
+func wipeDir(dir string) error {
+	filepath.Walk(dir, func(fileName string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			wipeFile(fileName)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// createPrivateFile creates a private directory holding a file only readable by the user
+func createPrivateFile(allowDisk bool, fileExt string) (*os.File, string, error) {
+	base, err := secureTempBaseDir(allowDisk)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir, err := ioutil.TempDir(base, "avh-")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = os.Chmod(dir, privateDirMode); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "vault"+fileExt), os.O_RDWR|os.O_CREATE|os.O_EXCL, privateFileMode)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	return file, dir, nil
+}
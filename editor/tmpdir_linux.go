@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package editor
+
+import "syscall"
+
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// isRAMBacked returns true if the directory is on a tmpfs or ramfs file system
+func isRAMBacked(dir string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	return stat.Type == tmpfsMagic || stat.Type == ramfsMagic
+}
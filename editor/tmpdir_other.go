@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package editor
+
+// isRAMBacked can't tell a RAM backed file system on this platform
+func isRAMBacked(dir string) bool {
+	return false
+}
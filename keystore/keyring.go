@@ -0,0 +1,195 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// freedesktop secret service api, see https://specifications.freedesktop.org/secret-service/
+const (
+	secretService     = "org.freedesktop.secrets"
+	secretServicePath = "/org/freedesktop/secrets"
+	defaultCollection = "/org/freedesktop/secrets/aliases/default"
+
+	serviceInterface    = "org.freedesktop.Secret.Service"
+	collectionInterface = "org.freedesktop.Secret.Collection"
+	itemInterface       = "org.freedesktop.Secret.Item"
+	promptInterface     = "org.freedesktop.Secret.Prompt"
+
+	itemLabel      = "org.freedesktop.Secret.Item.Label"
+	itemAttributes = "org.freedesktop.Secret.Item.Attributes"
+
+	// attributes used by python keyring and other tools storing passwords
+	attributeService = "service"
+	attributeAccount = "username"
+)
+
+// promptTimeout is how long the user has to answer a prompt of the secret service
+var promptTimeout = 2 * time.Minute
+
+var (
+	// ErrNoSecretService is returned when no secret service answers on the session bus
+	ErrNoSecretService = errors.New("no secret service on the session bus")
+
+	// ErrPromptDismissed is returned when the user dismisses the unlock prompt of the keyring
+	ErrPromptDismissed = errors.New("keyring prompt dismissed")
+
+	// ErrPromptTimeout is returned when the unlock prompt of the keyring isn't answered in time
+	ErrPromptTimeout = errors.New("keyring prompt not answered in time")
+)
+
+// secret is the Secret struct of the api, (oayays)
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyring is a plain session of the secret service, secrets go through the user session bus only
+type keyring struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+	session dbus.ObjectPath
+}
+
+func openKeyring() (*keyring, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%v : %w", err, ErrNoSecretService)
+	}
+
+	k := &keyring{conn: conn, service: conn.Object(secretService, secretServicePath)}
+
+	var output dbus.Variant
+	if err = k.service.Call(serviceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &k.session); err != nil {
+		return nil, fmt.Errorf("%v : %w", err, ErrNoSecretService)
+	}
+
+	return k, nil
+}
+
+func (k *keyring) close() {
+	k.conn.Object(secretService, k.session).Call("org.freedesktop.Secret.Session.Close", 0)
+}
+
+// prompt shows a prompt of the secret service and waits for its result
+func (k *keyring) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	if path == "/" {
+		return dbus.Variant{}, nil
+	}
+
+	if err := k.conn.AddMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(promptInterface)); err != nil {
+		return dbus.Variant{}, err
+	}
+	defer k.conn.RemoveMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(promptInterface))
+
+	signals := make(chan *dbus.Signal, 1)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+
+	if err := k.conn.Object(secretService, path).Call(promptInterface+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, err
+	}
+
+	timeout := time.NewTimer(promptTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case signal, ok := <-signals:
+			// the connection to the session bus is closed
+			if !ok {
+				return dbus.Variant{}, ErrNoSecretService
+			}
+			if signal.Path != path || signal.Name != promptInterface+".Completed" || len(signal.Body) < 2 {
+				continue
+			}
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return dbus.Variant{}, ErrPromptDismissed
+			}
+			result, _ := signal.Body[1].(dbus.Variant)
+			return result, nil
+		case <-timeout.C:
+			k.conn.Object(secretService, path).Call(promptInterface+".Dismiss", 0)
+			return dbus.Variant{}, fmt.Errorf("%s : %w", promptTimeout, ErrPromptTimeout)
+		}
+	}
+}
+
+// unlock unlocks the objects, the secret service may prompt the user
+func (k *keyring) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var promptPath dbus.ObjectPath
+	if err := k.service.Call(serviceInterface+".Unlock", 0, objects).Store(&unlocked, &promptPath); err != nil {
+		return err
+	}
+	_, err := k.prompt(promptPath)
+	return err
+}
+
+func attributes(service, account string) map[string]string {
+	return map[string]string{attributeService: service, attributeAccount: account}
+}
+
+// KeyringGet returns the password of the account of the service from the secret service
+func KeyringGet(service, account string) (string, error) {
+	k, err := openKeyring()
+	if err != nil {
+		return "", err
+	}
+	defer k.close()
+
+	var unlocked, locked []dbus.ObjectPath
+	if err = k.service.Call(serviceInterface+".SearchItems", 0, attributes(service, account)).Store(&unlocked, &locked); err != nil {
+		return "", err
+	}
+
+	if len(unlocked) == 0 && len(locked) > 0 {
+		if err = k.unlock(locked[:1]); err != nil {
+			return "", err
+		}
+		unlocked = locked[:1]
+	}
+	if len(unlocked) == 0 {
+		return "", fmt.Errorf("keyring %s/%s : %w", service, account, ErrNotFound)
+	}
+
+	var s secret
+	if err = k.conn.Object(secretService, unlocked[0]).Call(itemInterface+".GetSecret", 0, k.session).Store(&s); err != nil {
+		return "", err
+	}
+
+	return string(s.Value), nil
+}
+
+// KeyringSet stores the password of the account of the service in the default collection of the secret service,
+// it replaces the previous one if any
+func KeyringSet(service, account, label, password string) error {
+	k, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	defer k.close()
+
+	collection := dbus.ObjectPath(defaultCollection)
+	if err = k.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		itemLabel:      dbus.MakeVariant(label),
+		itemAttributes: dbus.MakeVariant(attributes(service, account)),
+	}
+	s := secret{Session: k.session, Value: []byte(password), ContentType: "text/plain"}
+
+	var item, promptPath dbus.ObjectPath
+	if err = k.conn.Object(secretService, collection).Call(collectionInterface+".CreateItem", 0, properties, s, true).Store(&item, &promptPath); err != nil {
+		return err
+	}
+	_, err = k.prompt(promptPath)
+	return err
+}
@@ -0,0 +1,262 @@
+package keystore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// mockService is a secret service with a plain session, it prompts to unlock locked items
+type mockService struct {
+	conn *dbus.Conn
+	mu   sync.Mutex
+	// answer of the prompts : "complete", "dismiss" or "" to never answer
+	answer string
+	items  map[dbus.ObjectPath]*mockItem
+}
+
+type mockItem struct {
+	service  *mockService
+	attrs    map[string]string
+	value    []byte
+	locked   bool
+	prompted bool
+}
+
+type mockCollection struct {
+	service *mockService
+}
+
+type mockPrompt struct {
+	service *mockService
+	path    dbus.ObjectPath
+	objects []dbus.ObjectPath
+}
+
+type mockSession struct{}
+
+func (s *mockService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", nil)
+	}
+	path := dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+	s.conn.Export(mockSession{}, path, "org.freedesktop.Secret.Session")
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (s *mockService) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for path, item := range s.items {
+		if item.attrs[attributeService] != attrs[attributeService] || item.attrs[attributeAccount] != attrs[attributeAccount] {
+			continue
+		}
+		if item.locked {
+			locked = append(locked, path)
+		} else {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, locked, nil
+}
+
+// Unlock always prompts for locked items
+func (s *mockService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlocked := []dbus.ObjectPath{}
+	for _, path := range objects {
+		if item, ok := s.items[path]; !ok || !item.locked {
+			unlocked = append(unlocked, path)
+		} else {
+			prompt := &mockPrompt{service: s, path: path + "/prompt", objects: []dbus.ObjectPath{path}}
+			s.conn.Export(prompt, prompt.path, promptInterface)
+			return unlocked, prompt.path, nil
+		}
+	}
+	return unlocked, "/", nil
+}
+
+func (c *mockCollection) CreateItem(properties map[string]dbus.Variant, s secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	c.service.mu.Lock()
+	defer c.service.mu.Unlock()
+
+	attrs, _ := properties[itemAttributes].Value().(map[string]string)
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", len(c.service.items)+1))
+	item := &mockItem{service: c.service, attrs: attrs, value: s.Value}
+	c.service.items[path] = item
+	c.service.conn.Export(item, path, itemInterface)
+	return path, "/", nil
+}
+
+func (i *mockItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+
+	if i.locked {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	return secret{Session: session, Value: i.value, ContentType: "text/plain"}, nil
+}
+
+func (p *mockPrompt) Prompt(windowID string) *dbus.Error {
+	p.service.mu.Lock()
+	defer p.service.mu.Unlock()
+
+	for _, path := range p.objects {
+		p.service.items[path].prompted = true
+	}
+
+	switch p.service.answer {
+	case "complete":
+		for _, path := range p.objects {
+			p.service.items[path].locked = false
+		}
+		go p.service.conn.Emit(p.path, promptInterface+".Completed", false, dbus.MakeVariant(p.objects))
+	case "dismiss":
+		go p.service.conn.Emit(p.path, promptInterface+".Completed", true, dbus.MakeVariant(""))
+	}
+	return nil
+}
+
+func (p *mockPrompt) Dismiss() *dbus.Error {
+	return nil
+}
+
+func (mockSession) Close() *dbus.Error {
+	return nil
+}
+
+// startSessionBus runs a private session bus for the test, it is stopped by the returned function
+func startSessionBus(t *testing.T) (string, func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	dir, err := ioutil.TempDir("", "avh-dbus-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address", "--address=unix:path="+filepath.Join(dir, "bus"))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("dbus-daemon : %v", err)
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+			os.RemoveAll(dir)
+		})
+	}
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		stop()
+		t.Skipf("dbus-daemon : %v", err)
+	}
+
+	return strings.TrimSpace(address), stop
+}
+
+func TestKeyring(t *testing.T) {
+	address, stop := startSessionBus(t)
+	defer stop()
+
+	defer setEnv("DBUS_SESSION_BUS_ADDRESS", address)()
+
+	if _, err := KeyringGet("ansible", "prod"); !errors.Is(err, ErrNoSecretService) {
+		t.Errorf("no service : got %v, want %v", err, ErrNoSecretService)
+	}
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	service := &mockService{conn: conn, answer: "complete", items: map[dbus.ObjectPath]*mockItem{}}
+	conn.Export(service, secretServicePath, serviceInterface)
+	conn.Export(&mockCollection{service: service}, defaultCollection, collectionInterface)
+	if reply, err := conn.RequestName(secretService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name : %v %v", reply, err)
+	}
+
+	if err = KeyringSet("ansible", "prod", "ansible prod", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := KeyringGet("ansible", "prod"); err != nil || password != "secret" {
+		t.Errorf("get : got %q, %v", password, err)
+	}
+	if _, err = KeyringGet("ansible", "dev"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown account : got %v, want %v", err, ErrNotFound)
+	}
+
+	// lock locks the items, the prompts give the answer
+	lock := func(answer string) {
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		service.answer = answer
+		for _, item := range service.items {
+			item.locked = true
+			item.prompted = false
+		}
+	}
+	prompted := func() bool {
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		for _, item := range service.items {
+			return item.prompted
+		}
+		return false
+	}
+
+	// the prompt unlocks the item
+	lock("complete")
+	if password, err := KeyringGet("ansible", "prod"); err != nil || password != "secret" || !prompted() {
+		t.Errorf("prompt : got %q, %v, prompted %v", password, err, prompted())
+	}
+
+	lock("dismiss")
+	if _, err = KeyringGet("ansible", "prod"); !errors.Is(err, ErrPromptDismissed) {
+		t.Errorf("dismissed prompt : got %v, want %v", err, ErrPromptDismissed)
+	}
+
+	defer func(timeout time.Duration) { promptTimeout = timeout }(promptTimeout)
+	promptTimeout = 100 * time.Millisecond
+	lock("")
+	if _, err = KeyringGet("ansible", "prod"); !errors.Is(err, ErrPromptTimeout) {
+		t.Errorf("unanswered prompt : got %v, want %v", err, ErrPromptTimeout)
+	}
+
+	// the bus goes away while the prompt is shown
+	promptTimeout = time.Minute
+	time.AfterFunc(100*time.Millisecond, stop)
+	start := time.Now()
+	if _, err = KeyringGet("ansible", "prod"); !errors.Is(err, ErrNoSecretService) {
+		t.Errorf("bus stopped : got %v, want %v", err, ErrNoSecretService)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("bus stopped : returned after %s", elapsed)
+	}
+}
@@ -0,0 +1,7 @@
+// Package keystore reads and stores vault passwords in the secret service of the desktop and in the password store of pass
+package keystore
+
+import "errors"
+
+// ErrNotFound is returned when the store holds no password for the name
+var ErrNotFound = errors.New("password not found")
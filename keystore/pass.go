@@ -0,0 +1,152 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// password store of pass(1), see https://www.passwordstore.org
+const (
+	passStoreEnv     = "PASSWORD_STORE_DIR"
+	passStoreKeyEnv  = "PASSWORD_STORE_KEY"
+	passStoreOptsEnv = "PASSWORD_STORE_GPG_OPTS"
+	passStoreDir     = ".password-store"
+	passGpgID        = ".gpg-id"
+	passExt          = ".gpg"
+)
+
+var (
+	// ErrNoRecipient is returned when no .gpg-id gives the keys to encrypt a password for
+	ErrNoRecipient = errors.New("password store not initialized, run pass init")
+
+	// ErrInvalidName is returned for a name outside of the store
+	ErrInvalidName = errors.New("invalid password name")
+)
+
+// passStore returns the directory of the password store, $PASSWORD_STORE_DIR or ~/.password-store
+func passStore() (string, error) {
+	if dir := os.Getenv(passStoreEnv); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, passStoreDir), nil
+}
+
+// passFile returns the encrypted file of the password name
+func passFile(name string) (string, string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("%s : %w", name, ErrInvalidName)
+	}
+
+	store, err := passStore()
+	if err != nil {
+		return "", "", err
+	}
+
+	return store, filepath.Join(store, clean+passExt), nil
+}
+
+// gpgOptions are the options pass gives to gpg
+func gpgOptions() []string {
+	return append(strings.Fields(os.Getenv(passStoreOptsEnv)), "--quiet", "--yes", "--compress-algo=none", "--no-encrypt-to")
+}
+
+func runGpg(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", append(gpgOptions(), args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg : %v : %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// PassGet returns the password of the name from the password store, the first line of the decrypted file as pass does
+func PassGet(name string) (string, error) {
+	_, fileName, err := passFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(fileName); os.IsNotExist(err) {
+		return "", fmt.Errorf("pass %s : %w", name, ErrNotFound)
+	}
+
+	content, err := runGpg(nil, "--decrypt", fileName)
+	if err != nil {
+		return "", fmt.Errorf("pass %s : %w", name, err)
+	}
+
+	line, err := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+	if line == "" && err != nil {
+		return "", fmt.Errorf("pass %s : %w", name, ErrNotFound)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// passRecipients returns the keys of the nearest .gpg-id from the directory of the file up to the store,
+// $PASSWORD_STORE_KEY takes precedence as in pass
+func passRecipients(store, fileName string) ([]string, error) {
+	if keys := strings.Fields(os.Getenv(passStoreKeyEnv)); len(keys) > 0 {
+		return keys, nil
+	}
+
+	for dir := filepath.Dir(fileName); ; dir = filepath.Dir(dir) {
+		if content, err := ioutil.ReadFile(filepath.Join(dir, passGpgID)); err == nil {
+			keys := []string{}
+			for _, line := range strings.Split(string(content), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					keys = append(keys, line)
+				}
+			}
+			if len(keys) > 0 {
+				return keys, nil
+			}
+		}
+		if dir == filepath.Clean(store) || dir == filepath.Dir(dir) {
+			return nil, ErrNoRecipient
+		}
+	}
+}
+
+// PassSet encrypts the password of the name in the password store for the keys of its .gpg-id
+func PassSet(name, password string) error {
+	store, fileName, err := passFile(name)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := passRecipients(store, fileName)
+	if err != nil {
+		return fmt.Errorf("pass %s : %w", name, err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+
+	args := []string{"--encrypt", "--output", fileName}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+
+	if _, err = runGpg([]byte(password+"\n"), args...); err != nil {
+		return fmt.Errorf("pass %s : %w", name, err)
+	}
+
+	return nil
+}
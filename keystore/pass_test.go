@@ -0,0 +1,89 @@
+package keystore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// setEnv sets the variable for the test, the returned function restores it
+func setEnv(name, value string) func() {
+	previous, set := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestPass(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	dir, err := ioutil.TempDir("", "avh-pass-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	home := filepath.Join(dir, "gnupg")
+	store := filepath.Join(dir, "store")
+	if err = os.Mkdir(home, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setEnv("GNUPGHOME", home)()
+	defer setEnv(passStoreEnv, store)()
+	defer setEnv(passStoreKeyEnv, "")()
+	defer setEnv(passStoreOptsEnv, "--batch --pinentry-mode loopback --passphrase=")()
+	defer exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+
+	if output, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "avh@example.com", "default", "default", "never").CombinedOutput(); err != nil {
+		t.Skipf("gpg key : %v : %s", err, output)
+	}
+
+	if err = PassSet("ansible/prod", "secret"); !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("no .gpg-id : got %v, want %v", err, ErrNoRecipient)
+	}
+
+	if err = os.MkdirAll(store, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(store, passGpgID), []byte("# team\navh@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = PassSet("ansible/prod", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(store, "ansible", "prod"+passExt)); err != nil {
+		t.Error(err)
+	}
+	if password, err := PassGet("ansible/prod"); err != nil || password != "secret" {
+		t.Errorf("get : got %q, %v", password, err)
+	}
+
+	// a file written by pass keeps the password on the first line
+	if err = PassSet("ansible/dev", "dev\nurl: https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := PassGet("ansible/dev"); err != nil || password != "dev" {
+		t.Errorf("multiline : got %q, %v", password, err)
+	}
+
+	if _, err = PassGet("ansible/qa"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown name : got %v, want %v", err, ErrNotFound)
+	}
+	for _, name := range []string{"", "../prod", "/etc/prod", "ansible/../../prod"} {
+		if _, err = PassGet(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%q : got %v, want %v", name, err, ErrInvalidName)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/pleclech/ansible-vault-helper/agent"
+)
+
+// AgentID returns the id of the key in the agent, label@source with an absolute source,
+// empty for a key given as a value
+func (k Key) AgentID() string {
+	label := k.Label
+	if label == "" {
+		label = DefaultLabel
+	}
+
+	switch {
+	case k.IsPrompt, k.IsKeyring, k.IsPass:
+		return label + vaultIDSep + k.Source()
+	case k.IsFile:
+		source, err := filepath.Abs(k.Value)
+		if err != nil {
+			source = k.Value
+		}
+		return label + vaultIDSep + source
+	}
+
+	return ""
+}
+
+// agentKey returns the password of the key held by the agent of AVH_AGENT_SOCK,
+// an agent that is not running or locked is ignored
+func agentKey(k Key) (string, bool) {
+	client := agent.FromEnv()
+	id := k.AgentID()
+	if client == nil || id == "" {
+		return "", false
+	}
+
+	password, err := client.Get(id)
+	if err != nil {
+		return "", false
+	}
+	return password, true
+}
+
+// pendingKey is the raw key of a source, added to the agent once one of its passwords opened or sealed a vault
+type pendingKey struct {
+	id  string
+	raw string
+}
+
+var (
+	pendingMu   sync.Mutex
+	pendingKeys = map[string]pendingKey{}
+)
+
+// cacheKey keeps the raw key of the source, the content of the file or the output of the executable,
+// until one of the passwords derived from it decrypts or encrypts a vault
+func cacheKey(k Key, raw string, passwords ...string) {
+	id := k.AgentID()
+	if agent.FromEnv() == nil || id == "" || raw == "" {
+		return
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	for _, password := range passwords {
+		if password != "" {
+			pendingKeys[password] = pendingKey{id: id, raw: raw}
+		}
+	}
+}
+
+// keyUsed adds the raw key the password comes from to the agent if it's pending
+func keyUsed(password string) {
+	pendingMu.Lock()
+	pending, ok := pendingKeys[password]
+	if ok {
+		for other, key := range pendingKeys {
+			if key.id == pending.id {
+				delete(pendingKeys, other)
+			}
+		}
+	}
+	pendingMu.Unlock()
+
+	if client := agent.FromEnv(); ok && client != nil {
+		client.Add(pending.id, pending.raw, 0)
+	}
+}
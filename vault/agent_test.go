@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pleclech/ansible-vault-helper/agent"
+)
+
+// startAgent serves an agent on a socket of the directory, AVH_AGENT_SOCK is set until the returned function is called
+func startAgent(t *testing.T, dir string) (*agent.Client, func()) {
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := agent.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := agent.NewServer(0)
+	go server.Serve(listener)
+
+	previous, set := os.LookupEnv(agent.EnvSocket)
+	os.Setenv(agent.EnvSocket, socket)
+
+	return agent.NewClient(socket), func() {
+		server.Stop()
+		if set {
+			os.Setenv(agent.EnvSocket, previous)
+		} else {
+			os.Unsetenv(agent.EnvSocket)
+		}
+	}
+}
+
+func TestAgentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-vault-agent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client, stop := startAgent(t, dir)
+	defer stop()
+	defer func(raw bool) { RawKeys = raw }(RawKeys)
+
+	script := filepath.Join(dir, "key.sh")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho "+testPassword+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := Key{Label: "dev", Value: script, IsFile: true, IsExec: true}
+	encrypted := testVault(t, "secret", "dev")
+
+	// a key that doesn't open the vault isn't cached
+	RawKeys = true
+	key, alternate, err := GetKeyWithAlternate(source, "")
+	if err != nil || key != testPassword+"\n" || alternate != testPassword {
+		t.Fatalf("raw key : got %q, %q, %v", key, alternate, err)
+	}
+	if _, err = DecryptBytes([]byte(encrypted), key); err == nil {
+		t.Fatal("raw key decrypted the vault")
+	}
+	if _, err = client.Get(source.AgentID()); err == nil {
+		t.Error("cached before the vault was opened")
+	}
+
+	// the key is cached as read once its alternate opened the vault
+	if _, err = DecryptBytes([]byte(encrypted), alternate); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := client.Get(source.AgentID()); err != nil || cached != testPassword+"\n" {
+		t.Errorf("cached : got %q, %v", cached, err)
+	}
+
+	// the cached key is normalized unless RawKeys is set
+	if err = os.Remove(script); err != nil {
+		t.Fatal(err)
+	}
+	RawKeys = false
+	if key, alternate, err = GetKeyWithAlternate(source, ""); err != nil || key != testPassword || alternate != testPassword+"\n" {
+		t.Errorf("normalized from the agent : got %q, %q, %v", key, alternate, err)
+	}
+	RawKeys = true
+	if key, alternate, err = GetKeyWithAlternate(source, ""); err != nil || key != testPassword+"\n" || alternate != testPassword {
+		t.Errorf("raw from the agent : got %q, %q, %v", key, alternate, err)
+	}
+}
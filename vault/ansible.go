@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ansibleConfigName     = "ansible.cfg"
+	ansibleDefaultsConfig = "defaults"
+
+	envAnsibleConfig          = "ANSIBLE_CONFIG"
+	envAnsiblePasswordFile    = "ANSIBLE_VAULT_PASSWORD_FILE"
+	envAnsibleIdentityList    = "ANSIBLE_VAULT_IDENTITY_LIST"
+	envAnsibleIdentity        = "ANSIBLE_VAULT_IDENTITY"
+	envAnsibleEncryptIdentity = "ANSIBLE_VAULT_ENCRYPT_IDENTITY"
+)
+
+// AnsibleVaultConfig holds the vault settings of ansible taken from ansible.cfg and ANSIBLE_VAULT_* env variables
+type AnsibleVaultConfig struct {
+	// ConfigFile is the ansible.cfg read, empty if none is found
+	ConfigFile string
+	// PasswordFile is vault_password_file, a file or an executable
+	PasswordFile string
+	// IdentityList is vault_identity_list, label@source vault-ids
+	IdentityList []string
+	// Identity is vault_identity, the label of the password file
+	Identity string
+	// EncryptIdentity is vault_encrypt_identity, the label of the vault-id used for encryption
+	EncryptIdentity string
+}
+
+// FindAnsibleConfig returns the ansible.cfg ansible would read, from ANSIBLE_CONFIG, the current directory,
+// ~/.ansible.cfg or /etc/ansible/ansible.cfg, it returns an empty string if there is none
+func FindAnsibleConfig() string {
+	candidates := []string{}
+
+	if fileName := os.Getenv(envAnsibleConfig); fileName != "" {
+		fileName = expandPath(fileName, "")
+		if stat, err := os.Stat(fileName); err == nil && stat.IsDir() {
+			fileName = filepath.Join(fileName, ansibleConfigName)
+		}
+		candidates = append(candidates, fileName)
+	}
+
+	// as ansible, the config of a world writable current directory is ignored
+	if cwd, err := os.Getwd(); err == nil {
+		if stat, err := os.Stat(cwd); err == nil && stat.Mode().Perm()&0002 == 0 {
+			candidates = append(candidates, filepath.Join(cwd, ansibleConfigName))
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, "."+ansibleConfigName))
+	}
+
+	candidates = append(candidates, filepath.Join("/etc/ansible", ansibleConfigName))
+
+	for _, fileName := range candidates {
+		if stat, err := os.Stat(fileName); err == nil && stat.Mode().IsRegular() {
+			return fileName
+		}
+	}
+
+	return ""
+}
+
+// LoadAnsibleVaultConfig reads the vault settings of the [defaults] section of ansible.cfg,
+// ANSIBLE_VAULT_* env variables take precedence as in ansible
+func LoadAnsibleVaultConfig() (*AnsibleVaultConfig, error) {
+	c := &AnsibleVaultConfig{Identity: DefaultLabel}
+
+	settings := map[string]string{}
+	if fileName := FindAnsibleConfig(); fileName != "" {
+		var err error
+		if settings, err = readIniSection(fileName, ansibleDefaultsConfig); err != nil {
+			return nil, err
+		}
+		c.ConfigFile = fileName
+	}
+
+	lookup := func(env string, key string) (string, bool) {
+		if value, ok := os.LookupEnv(env); ok {
+			return value, true
+		}
+		value, ok := settings[key]
+		return value, ok
+	}
+
+	if value, ok := os.LookupEnv(envAnsiblePasswordFile); ok {
+		c.PasswordFile = expandPath(value, "")
+	} else if value, ok := settings["vault_password_file"]; ok {
+		// paths of ansible.cfg are relative to its directory
+		c.PasswordFile = expandPath(value, filepath.Dir(c.ConfigFile))
+	}
+
+	if value, ok := lookup(envAnsibleIdentityList, "vault_identity_list"); ok {
+		for _, id := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if id = strings.TrimSpace(id); id != "" {
+				c.IdentityList = append(c.IdentityList, id)
+			}
+		}
+	}
+
+	if value, ok := lookup(envAnsibleIdentity, "vault_identity"); ok && value != "" {
+		c.Identity = value
+	}
+
+	if value, ok := lookup(envAnsibleEncryptIdentity, "vault_encrypt_identity"); ok {
+		c.EncryptIdentity = value
+	}
+
+	return c, nil
+}
+
+// VaultIDs returns the vault-ids given by the settings, the identity list followed by the password file
+func (c *AnsibleVaultConfig) VaultIDs() []string {
+	ids := append([]string{}, c.IdentityList...)
+	if c.PasswordFile != "" {
+		ids = append(ids, c.Identity+"@"+c.PasswordFile)
+	}
+	return ids
+}
+
+// expandPath expands env variables and ~, a relative path is made relative to dir if given
+func expandPath(fileName string, dir string) string {
+	fileName = os.ExpandEnv(fileName)
+	if fileName == "~" || strings.HasPrefix(fileName, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			fileName = filepath.Join(home, fileName[1:])
+		}
+	}
+	if dir != "" && !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(dir, fileName)
+	}
+	return fileName
+}
+
+// readIniSection returns the options of a section of an ini file, indented lines continue the previous value
+func readIniSection(fileName string, section string) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	options := map[string]string{}
+	current := ""
+	key := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		// inline comments start with ;
+		if idx := strings.Index(trimmed, " ;"); idx >= 0 {
+			trimmed = strings.TrimSpace(trimmed[:idx])
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			key = ""
+			continue
+		}
+		if current != section {
+			continue
+		}
+
+		if key != "" && (line[0] == ' ' || line[0] == '\t') {
+			options[key] += "\n" + trimmed
+			continue
+		}
+
+		idx := strings.IndexAny(trimmed, "=:")
+		if idx < 0 {
+			key = ""
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(trimmed[:idx]))
+		options[key] = strings.TrimSpace(trimmed[idx+1:])
+	}
+
+	return options, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	fileName := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestReadIniSection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-ini-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "key values",
+			content: "[defaults]\nvault_password_file = ~/.vault_pass\nVault_Identity: dev\n",
+			want:    map[string]string{"vault_password_file": "~/.vault_pass", "vault_identity": "dev"},
+		},
+		{
+			name:    "other sections are skipped",
+			content: "[ssh_connection]\npipelining = True\n[defaults]\nforks = 5\n[galaxy]\nforks = 10\n",
+			want:    map[string]string{"forks": "5"},
+		},
+		{
+			name:    "comments",
+			content: "# comment\n; comment\n[defaults]\n  # indented comment\nvault_identity = dev ; inline comment\nvault_password_file = pass;word\n",
+			want:    map[string]string{"vault_identity": "dev", "vault_password_file": "pass;word"},
+		},
+		{
+			name:    "continuation lines",
+			content: "[defaults]\nvault_identity_list = dev@dev.txt,\n    prod@prod.txt\n\tqa@qa.txt\nforks = 5\n",
+			want:    map[string]string{"vault_identity_list": "dev@dev.txt,\nprod@prod.txt\nqa@qa.txt", "forks": "5"},
+		},
+		{
+			name:    "value with separators",
+			content: "[defaults]\nvault_identity_list = dev@a=b:c\nempty =\n",
+			want:    map[string]string{"vault_identity_list": "dev@a=b:c", "empty": ""},
+		},
+		{
+			name:    "no section",
+			content: "vault_identity = dev\n",
+			want:    map[string]string{},
+		},
+		{
+			name:    "crlf",
+			content: "[defaults]\r\nvault_identity = dev\r\n",
+			want:    map[string]string{"vault_identity": "dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		fileName := writeTestFile(t, dir, "ansible.cfg", tt.content)
+		got, err := readIniSection(fileName, ansibleDefaultsConfig)
+		if err != nil {
+			t.Errorf("%s : %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s : got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err = readIniSection(filepath.Join(dir, "missing.cfg"), ansibleDefaultsConfig); err == nil {
+		t.Error("missing file : got no error")
+	}
+}
+
+func TestLoadAnsibleVaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-ansible-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envs := []string{envAnsibleConfig, envAnsiblePasswordFile, envAnsibleIdentityList, envAnsibleIdentity, envAnsibleEncryptIdentity}
+	for _, env := range envs {
+		if value, ok := os.LookupEnv(env); ok {
+			defer os.Setenv(env, value)
+		} else {
+			defer os.Unsetenv(env)
+		}
+		os.Unsetenv(env)
+	}
+
+	configFile := writeTestFile(t, dir, "ansible.cfg", "[defaults]\nvault_password_file = pass.txt\nvault_identity = dev\nvault_identity_list = a@a.txt, b@b.txt\nvault_encrypt_identity = a\n")
+	os.Setenv(envAnsibleConfig, dir)
+
+	c, err := LoadAnsibleVaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AnsibleVaultConfig{
+		ConfigFile:      configFile,
+		PasswordFile:    filepath.Join(dir, "pass.txt"),
+		IdentityList:    []string{"a@a.txt", "b@b.txt"},
+		Identity:        "dev",
+		EncryptIdentity: "a",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if ids, want := c.VaultIDs(), []string{"a@a.txt", "b@b.txt", "dev@" + filepath.Join(dir, "pass.txt")}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got vault-ids %q, want %q", ids, want)
+	}
+
+	// env variables take precedence, relative paths are kept
+	os.Setenv(envAnsiblePasswordFile, "env.txt")
+	os.Setenv(envAnsibleIdentityList, "")
+	os.Setenv(envAnsibleIdentity, "prod")
+	os.Setenv(envAnsibleEncryptIdentity, "prod")
+
+	if c, err = LoadAnsibleVaultConfig(); err != nil {
+		t.Fatal(err)
+	}
+	want = &AnsibleVaultConfig{ConfigFile: configFile, PasswordFile: "env.txt", Identity: "prod", EncryptIdentity: "prod"}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("env : got %+v, want %+v", c, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/subtle"
 )
 
 func encrypt(data []byte, salt []byte, key *key) ([]byte, error) {
@@ -21,10 +22,10 @@ func encrypt(data []byte, salt []byte, key *key) ([]byte, error) {
 	return ciphertext, nil
 }
 
-func decrypt(secret *secret, key *key) (string, error) {
+func decrypt(secret *secret, key *key) ([]byte, error) {
 	aesCipher, err := aes.NewCipher(key.cipherKey)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	plainText := make([]byte, len(secret.data))
@@ -32,25 +33,37 @@ func decrypt(secret *secret, key *key) (string, error) {
 	aesBlock := cipher.NewCTR(aesCipher, key.iv)
 	aesBlock.XORKeyStream(plainText, secret.data)
 
-	result, err := unpad(plainText)
-	if err != nil {
-		return "", err
-	}
-
-	return string(result), nil
+	return unpad(plainText)
 }
 
 func pad(src []byte) []byte {
 	padlen := aes.BlockSize - len(src)%aes.BlockSize
 	padtext := bytes.Repeat([]byte{byte(padlen)}, padlen)
-	return append(src, padtext...)
+	// never append into the caller's slice
+	return append(append(make([]byte, 0, len(src)+padlen), src...), padtext...)
 }
 
+// unpad removes the PKCS#7 padding, every pad byte is checked in constant time
 func unpad(src []byte) ([]byte, error) {
 	length := len(src)
-	padlen := int(src[length-1])
-	if padlen > length {
+	if length == 0 {
+		return nil, ErrEmptyCiphertext
+	}
+	if length%aes.BlockSize != 0 {
 		return nil, ErrInvalidPadding
 	}
-	return src[:(length - padlen)], nil
-}
\ No newline at end of file
+
+	padlen := src[length-1]
+	// good is 1 while the padding is valid
+	good := subtle.ConstantTimeLessOrEq(1, int(padlen)) & subtle.ConstantTimeLessOrEq(int(padlen), aes.BlockSize)
+	for i := 1; i <= aes.BlockSize; i++ {
+		inPad := subtle.ConstantTimeLessOrEq(i, int(padlen))
+		equal := subtle.ConstantTimeByteEq(src[length-i], padlen)
+		good &= equal | (inPad ^ 1)
+	}
+	if good != 1 {
+		return nil, ErrInvalidPadding
+	}
+
+	return src[:length-int(padlen)], nil
+}
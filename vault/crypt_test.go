@@ -0,0 +1,56 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnpad(t *testing.T) {
+	block := func(content string, padding ...byte) []byte {
+		return append([]byte(content), padding...)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+		err   error
+	}{
+		{name: "one byte", input: block("0123456789abcde", 1), want: "0123456789abcde"},
+		{name: "full block", input: block("0123456789abcdef", bytes.Repeat([]byte{16}, 16)...), want: "0123456789abcdef"},
+		{name: "short", input: block("abc", bytes.Repeat([]byte{13}, 13)...), want: "abc"},
+		{name: "empty plaintext", input: bytes.Repeat([]byte{16}, 16), want: ""},
+		{name: "empty", input: []byte{}, err: ErrEmptyCiphertext},
+		{name: "not a block", input: block("abc", 1), err: ErrInvalidPadding},
+		{name: "zero", input: block("0123456789abcde", 0), err: ErrInvalidPadding},
+		{name: "too long", input: block("0123456789abcde", 17), err: ErrInvalidPadding},
+		{name: "wrong byte", input: block("0123456789abc", 3, 2, 3), err: ErrInvalidPadding},
+		{name: "first pad byte wrong", input: block("0123456789abc", 1, 3, 3), err: ErrInvalidPadding},
+		{name: "full block wrong byte", input: append([]byte{15}, bytes.Repeat([]byte{16}, 15)...), err: ErrInvalidPadding},
+	}
+
+	for _, tt := range tests {
+		got, err := unpad(tt.input)
+		if err != tt.err {
+			t.Errorf("%s : got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && string(got) != tt.want {
+			t.Errorf("%s : got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPadUnpad(t *testing.T) {
+	for size := 0; size <= 48; size++ {
+		input := bytes.Repeat([]byte{'x'}, size)
+		padded := pad(input)
+		if len(padded)%16 != 0 || len(padded) <= size {
+			t.Fatalf("size %d : padded to %d", size, len(padded))
+		}
+		got, err := unpad(padded)
+		if err != nil || !bytes.Equal(got, input) {
+			t.Errorf("size %d : got %q, %v", size, got, err)
+		}
+	}
+}
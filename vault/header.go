@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	vaultFormatID  = "$ANSIBLE_VAULT"
+	vaultCipher    = "AES256"
+	vaultVersion11 = "1.1"
+	vaultVersion12 = "1.2"
+	headerSep      = ";"
+	// maxHeaderLength bounds the first line looked at when checking binary content
+	maxHeaderLength = 1024
+
+	// DefaultLabel is the vault-id label used when none is given, it is never written in a header
+	DefaultLabel = "default"
+)
+
+// Header is the first line of an ansible vault envelope
+// $ANSIBLE_VAULT;<version>;<cipher>[;<vault-id label>]
+type Header struct {
+	Version string
+	Cipher  string
+	Label   string
+}
+
+// NewHeader returns the header to use when encrypting with the given vault-id label
+// version 1.2 is only used when a label other than default is given, as ansible-vault does
+func NewHeader(label string) *Header {
+	if label == "" || label == DefaultLabel {
+		return &Header{Version: vaultVersion11, Cipher: vaultCipher}
+	}
+	return &Header{Version: vaultVersion12, Cipher: vaultCipher, Label: label}
+}
+
+// ParseHeader parses the header found on the first line of the input
+func ParseHeader(input string) (*Header, error) {
+	if idx := strings.IndexByte(input, '\n'); idx >= 0 {
+		input = input[:idx]
+	}
+	if len(input) > maxHeaderLength {
+		return nil, ErrInvalidFormat
+	}
+	return parseHeaderLine(input)
+}
+
+// parseHeaderBytes parses the header found on the first line of binary input
+func parseHeaderBytes(input []byte) (*Header, error) {
+	if idx := bytes.IndexByte(input, '\n'); idx >= 0 {
+		input = input[:idx]
+	}
+	if len(input) > maxHeaderLength {
+		return nil, ErrInvalidFormat
+	}
+	return parseHeaderLine(string(input))
+}
+
+func parseHeaderLine(line string) (*Header, error) {
+	parts := strings.Split(strings.TrimSpace(line), headerSep)
+	if len(parts) < 3 || parts[0] != vaultFormatID {
+		return nil, ErrInvalidFormat
+	}
+
+	header := &Header{
+		Version: strings.TrimSpace(parts[1]),
+		Cipher:  strings.TrimSpace(parts[2]),
+	}
+
+	switch header.Version {
+	case vaultVersion11:
+		if len(parts) != 3 {
+			return nil, ErrInvalidFormat
+		}
+	case vaultVersion12:
+		if len(parts) != 4 {
+			return nil, ErrInvalidFormat
+		}
+		header.Label = strings.TrimSpace(parts[3])
+		if header.Label == "" {
+			return nil, ErrInvalidFormat
+		}
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+
+	if header.Cipher != vaultCipher {
+		return nil, ErrUnsupportedCipher
+	}
+
+	return header, nil
+}
+
+// HasLabel returns true if the header carries a vault-id label
+func (h Header) HasLabel() bool {
+	return h.Label != ""
+}
+
+func (h Header) String() string {
+	parts := []string{vaultFormatID, h.Version, h.Cipher}
+	if h.Version == vaultVersion12 {
+		parts = append(parts, h.Label)
+	}
+	return strings.Join(parts, headerSep)
+}
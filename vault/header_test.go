@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  *Header
+		err   error
+	}{
+		{input: "$ANSIBLE_VAULT;1.1;AES256", want: &Header{Version: "1.1", Cipher: "AES256"}},
+		{input: "$ANSIBLE_VAULT;1.1;AES256\n6162", want: &Header{Version: "1.1", Cipher: "AES256"}},
+		{input: "$ANSIBLE_VAULT;1.1;AES256\r\n6162", want: &Header{Version: "1.1", Cipher: "AES256"}},
+		{input: "  $ANSIBLE_VAULT;1.1;AES256  \n", want: &Header{Version: "1.1", Cipher: "AES256"}},
+		{input: "$ANSIBLE_VAULT;1.2;AES256;prod", want: &Header{Version: "1.2", Cipher: "AES256", Label: "prod"}},
+		{input: "$ANSIBLE_VAULT;1.2;AES256;my label", want: &Header{Version: "1.2", Cipher: "AES256", Label: "my label"}},
+		{input: "$ANSIBLE_VAULT;1.1;AES256;prod", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.2;AES256", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.2;AES256;", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.2;AES256;a;b", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.3;AES256", err: ErrUnsupportedVersion},
+		{input: "$ANSIBLE_VAULT;1.0;AES", err: ErrUnsupportedVersion},
+		{input: "$ANSIBLE_VAULT;1.1;AES128", err: ErrUnsupportedCipher},
+		{input: "$ANSIBLE_VAULT;1.1", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT", err: ErrInvalidFormat},
+		{input: "ANSIBLE_VAULT;1.1;AES256", err: ErrInvalidFormat},
+		{input: "", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.2;AES256;" + strings.Repeat("x", maxHeaderLength), err: ErrInvalidFormat},
+	}
+
+	for _, tt := range tests {
+		header, err := ParseHeader(tt.input)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%q : got error %v, want %v", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q : %v", tt.input, err)
+			continue
+		}
+		if *header != *tt.want {
+			t.Errorf("%q : got %+v, want %+v", tt.input, header, tt.want)
+		}
+	}
+}
+
+func TestHeaderString(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{label: "", want: "$ANSIBLE_VAULT;1.1;AES256"},
+		{label: DefaultLabel, want: "$ANSIBLE_VAULT;1.1;AES256"},
+		{label: "prod", want: "$ANSIBLE_VAULT;1.2;AES256;prod"},
+	}
+
+	for _, tt := range tests {
+		if got := NewHeader(tt.label).String(); got != tt.want {
+			t.Errorf("%q : got %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestMaybeEncrypted(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "$ANSIBLE_VAULT;1.1;AES256\n6162", want: true},
+		{input: "$ANSIBLE_VAULT;1.3;AES256\n6162", want: true},
+		{input: "$ANSIBLE_VAULT;1.1;AES128\n6162", want: true},
+		{input: "  $ANSIBLE_VAULT;1.2;AES256;dev\n", want: true},
+		{input: "$ANSIBLE_VAULT\n", want: false},
+		{input: "# $ANSIBLE_VAULT;1.1;AES256\n", want: false},
+		{input: "user: admin\n", want: false},
+		{input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := MaybeEncrypted(tt.input); got != tt.want {
+			t.Errorf("MaybeEncrypted(%q) : got %v, want %v", tt.input, got, tt.want)
+		}
+		if got := MaybeEncryptedBytes([]byte(tt.input)); got != tt.want {
+			t.Errorf("MaybeEncryptedBytes(%q) : got %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func FuzzParseHeader(f *testing.F) {
+	for _, seed := range []string{
+		"$ANSIBLE_VAULT;1.1;AES256",
+		"$ANSIBLE_VAULT;1.2;AES256;prod\n6162",
+		"$ANSIBLE_VAULT;1.2;AES256;",
+		"$ANSIBLE_VAULT;1.3;AES256",
+		"$ANSIBLE_VAULT;1.1;AES128",
+		"$ANSIBLE_VAULT;;;;",
+		"\n$ANSIBLE_VAULT;1.1;AES256",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		header, err := ParseHeader(input)
+		if err != nil {
+			if header != nil {
+				t.Fatalf("%q : header %+v returned with error %v", input, header, err)
+			}
+			return
+		}
+
+		// a parsed header is written back as it was read
+		again, err := ParseHeader(header.String())
+		if err != nil {
+			t.Fatalf("%q : %s can't be parsed again : %v", input, header, err)
+		}
+		if *again != *header {
+			t.Fatalf("%q : got %+v after a round trip, want %+v", input, again, header)
+		}
+		if !MaybeEncrypted(header.String()) {
+			t.Fatalf("%q : %s isn't detected as a vault", input, header)
+		}
+	})
+}
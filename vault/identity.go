@@ -0,0 +1,179 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	vaultIDSep        = "@"
+	vaultIDPrompt     = "prompt"
+	vaultIDPromptPass = "prompt_ask_vault_pass"
+)
+
+var (
+	// ErrNoIdentity is returned when there is no password to decrypt or encrypt with
+	ErrNoIdentity = errors.New("no vault identity available")
+
+	// ErrUnknownVaultID is returned when a vault-id label doesn't match any identity
+	ErrUnknownVaultID = errors.New("unknown vault-id")
+)
+
+// Identity is a vault password bound to a vault-id label
+type Identity struct {
+	Label    string
+	Password string
+	// Alternate is tried when the password fails, the key before normalization or normalized with RawKeys
+	Alternate string
+}
+
+// Identities is an ordered list of vault identities
+type Identities []Identity
+
+// ParseVaultID parses a label@source vault-id as ansible does
+// source can be prompt, keyring:service/account, pass:name, an executable file or a plain file,
+// without label the default one is used
+func ParseVaultID(vaultID string) (Key, error) {
+	label := DefaultLabel
+	source := vaultID
+
+	if idx := strings.Index(vaultID, vaultIDSep); idx >= 0 {
+		label = vaultID[:idx]
+		source = vaultID[idx+1:]
+	}
+
+	if label == "" || source == "" || strings.ContainsAny(label, headerSep+"\r\n") {
+		return Key{}, fmt.Errorf("%s : %w", vaultID, ErrInvalidLabel)
+	}
+
+	switch source {
+	case vaultIDPrompt, vaultIDPromptPass:
+		return Key{Label: label, IsPrompt: true}, nil
+	}
+
+	if key, ok := storeKey(label, source); ok {
+		return key, nil
+	}
+
+	stat, err := os.Stat(source)
+	if err != nil {
+		return Key{}, fmt.Errorf("vault-id %s : %w", label, ErrKeyFileNotFound)
+	}
+
+	return Key{
+		Label:  label,
+		Value:  source,
+		IsFile: true,
+		IsExec: !stat.IsDir() && (stat.Mode()&execModeAll) != 0,
+	}, nil
+}
+
+// Find returns the first identity with the given label
+func (ids Identities) Find(label string) (*Identity, bool) {
+	if label == "" {
+		label = DefaultLabel
+	}
+	for i := range ids {
+		if ids[i].Label == label {
+			return &ids[i], true
+		}
+	}
+	return nil, false
+}
+
+// candidates returns identities matching the label first followed by every other one in order
+func (ids Identities) candidates(label string) Identities {
+	if label == "" {
+		return ids
+	}
+	result := make(Identities, 0, len(ids))
+	for _, id := range ids {
+		if id.Label == label {
+			result = append(result, id)
+		}
+	}
+	for _, id := range ids {
+		if id.Label != label {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Decrypt decrypts the input with the identity matching the header label,
+// or with each identity in order when there is no label or none matches.
+// The returned identity has the header label and the password that opened the secret.
+func (ids Identities) Decrypt(input string) (string, Identity, error) {
+	result, id, err := ids.DecryptBytes([]byte(input))
+	return string(result), id, err
+}
+
+// DecryptBytes decrypts the input into binary data as Decrypt does
+func (ids Identities) DecryptBytes(input []byte) ([]byte, Identity, error) {
+	header, err := parseHeaderBytes(input)
+	if err != nil {
+		return nil, Identity{}, err
+	}
+
+	err = ErrNoIdentity
+	for _, id := range ids.candidates(header.Label) {
+		if id.Password == "" {
+			continue
+		}
+		var result []byte
+		result, err = DecryptBytes(input, id.Password)
+		if err == nil {
+			return result, Identity{Label: header.Label, Password: id.Password}, nil
+		}
+		if !errors.Is(err, ErrInvalidPassword) {
+			return nil, Identity{}, err
+		}
+	}
+
+	for _, id := range ids.candidates(header.Label) {
+		if id.Alternate == "" || !errors.Is(err, ErrInvalidPassword) {
+			continue
+		}
+		if result, altErr := DecryptBytes(input, id.Alternate); altErr == nil {
+			warnAlternate(id)
+			return result, Identity{Label: header.Label, Password: id.Alternate}, nil
+		}
+	}
+
+	if header.HasLabel() {
+		return nil, Identity{}, fmt.Errorf("vault-id %s : %w", header.Label, err)
+	}
+	return nil, Identity{}, err
+}
+
+// alternates returns the identities holding an alternate password with it as password
+func (ids Identities) alternates() Identities {
+	result := Identities{}
+	for _, id := range ids {
+		if id.Alternate != "" {
+			result = append(result, Identity{Label: id.Label, Password: id.Alternate, Alternate: id.Password})
+		}
+	}
+	return result
+}
+
+// warnAlternate tells that a vault was only decrypted by the alternate of the key of the identity,
+// so ansible-vault or avh without --key-raw can't decrypt it
+func warnAlternate(id Identity) {
+	if Warn == nil {
+		return
+	}
+
+	label := id.Label
+	if label == "" {
+		label = DefaultLabel
+	}
+
+	if len(id.Alternate) > len(id.Password) {
+		Warn(fmt.Sprintf("vault-id %s : the vault was encrypted with the whitespace around the key, ansible-vault strips it, use --key-raw or rekey the vault", label))
+		return
+	}
+	Warn(fmt.Sprintf("vault-id %s : the vault was encrypted with the key stripped of its whitespace, as ansible-vault does, don't use --key-raw", label))
+}
@@ -15,9 +15,15 @@ const (
 )
 
 type Key struct {
-	Value  string
-	IsFile bool
-	IsExec bool
+	Label    string
+	Value    string
+	IsFile   bool
+	IsExec   bool
+	IsPrompt bool
+	// the key is in the secret service, value is service/account
+	IsKeyring bool
+	// the key is in the password store of pass, value is the name of the password
+	IsPass bool
 }
 
 type KeyChoice struct {
@@ -1,46 +1,51 @@
 package vault
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
 	"strings"
 )
 
-const vaultHeader = "$ANSIBLE_VAULT;1.1;AES256"
-
 type secret struct {
 	salt []byte
 	hmac []byte
 	data []byte
 }
 
-func decodeSecret(input string) (*secret, error) {
-	lines := strings.SplitN(input, "\n", 3)
+func decodeSecret(input []byte) (*secret, error) {
+	lines := bytes.SplitN(input, []byte("\n"), 3)
 	if len(lines) != 3 {
-		return nil, errors.New("invalid secret")
+		return nil, ErrInvalidFormat
 	}
 
-	salt, err := hex.DecodeString(lines[0])
+	salt, err := hexDecode(lines[0])
 	if err != nil {
 		return nil, err
 	}
 
-	hmac, err := hex.DecodeString(lines[1])
+	hmac, err := hexDecode(lines[1])
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := hex.DecodeString(lines[2])
+	data, err := hexDecode(lines[2])
 	if err != nil {
 		return nil, err
 	}
 
+	if len(salt) == 0 || len(hmac) != sha256.Size {
+		return nil, ErrInvalidFormat
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyCiphertext
+	}
+
 	return &secret{salt, hmac, data}, nil
 }
 
-func encodeSecret(secret *secret, key *key, pad int) (string, error) {
+func encodeSecret(header *Header, secret *secret, key *key, pad int) (string, error) {
 	hmacEncrypt := hmac.New(sha256.New, key.hmacKey)
 	hmacEncrypt.Write(secret.data)
 	hexSalt := hex.EncodeToString(secret.salt)
@@ -56,7 +61,7 @@ func encodeSecret(secret *secret, key *key, pad int) (string, error) {
 	}, "\n")
 
 	result := strings.Join([]string{
-		vaultHeader,
+		header.String(),
 		wrapText(hex.EncodeToString([]byte(combined)), sep),
 	}, "\n"+sep)
 
@@ -67,7 +72,7 @@ func checkDigest(secret *secret, key *key) error {
 	hash := hmac.New(sha256.New, key.hmacKey)
 	hash.Write(secret.data)
 	if !hmac.Equal(hash.Sum(nil), secret.hmac) {
-		return errors.New("invalid password")
+		return ErrInvalidPassword
 	}
 	return nil
 }
@@ -88,15 +93,14 @@ func wrapText(text string, pad string) string {
 	return string(result)
 }
 
-func hexDecode(input string) (string, error) {
-	input = strings.TrimSpace(input)
-	input = strings.Replace(input, "\r", "", -1)
-	input = strings.Replace(input, "\n", "", -1)
+// hexDecode decodes hex text ignoring line breaks and indentation
+func hexDecode(input []byte) ([]byte, error) {
+	input = bytes.Join(bytes.Fields(input), nil)
 
-	decoded, err := hex.DecodeString(input)
-	if err != nil {
-		return "", err
+	decoded := make([]byte, hex.DecodedLen(len(input)))
+	if _, err := hex.Decode(decoded, input); err != nil {
+		return nil, ErrInvalidFormat
 	}
 
-	return string(decoded), nil
+	return decoded, nil
 }
@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pleclech/ansible-vault-helper/keystore"
+)
+
+const (
+	keyringPrefix = "keyring:"
+	passPrefix    = "pass:"
+)
+
+// ErrInvalidKeyring is returned when a keyring source is not keyring:service/account
+var ErrInvalidKeyring = fmt.Errorf("keyring source must be %sservice/account", keyringPrefix)
+
+// IsStoreSource returns true for a keyring:service/account or pass:name source
+func IsStoreSource(source string) bool {
+	return strings.HasPrefix(source, keyringPrefix) || strings.HasPrefix(source, passPrefix)
+}
+
+// storeKey returns the key of a keyring: or pass: source
+func storeKey(label, source string) (Key, bool) {
+	switch {
+	case strings.HasPrefix(source, keyringPrefix):
+		return Key{Label: label, Value: strings.TrimPrefix(source, keyringPrefix), IsKeyring: true}, true
+	case strings.HasPrefix(source, passPrefix):
+		return Key{Label: label, Value: strings.TrimPrefix(source, passPrefix), IsPass: true}, true
+	}
+	return Key{}, false
+}
+
+// Source returns the source of the key as written in a vault-id
+func (k Key) Source() string {
+	switch {
+	case k.IsPrompt:
+		return vaultIDPrompt
+	case k.IsKeyring:
+		return keyringPrefix + k.Value
+	case k.IsPass:
+		return passPrefix + k.Value
+	}
+	return k.Value
+}
+
+func splitKeyring(value string) (string, string, error) {
+	idx := strings.Index(value, "/")
+	if idx <= 0 || idx == len(value)-1 {
+		return "", "", fmt.Errorf("%s%s : %w", keyringPrefix, value, ErrInvalidKeyring)
+	}
+	return value[:idx], value[idx+1:], nil
+}
+
+// getStoreKey reads the key from the secret service or the password store
+func getStoreKey(k Key) (string, error) {
+	if k.IsKeyring {
+		service, account, err := splitKeyring(k.Value)
+		if err != nil {
+			return "", err
+		}
+		return keystore.KeyringGet(service, account)
+	}
+	return keystore.PassGet(k.Value)
+}
+
+// StoreKey saves the password of a keyring: or pass: source
+func StoreKey(source string, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	k, ok := storeKey(DefaultLabel, source)
+	if !ok {
+		return fmt.Errorf("%s : source must be %sservice/account or %sname", source, keyringPrefix, passPrefix)
+	}
+
+	if k.IsKeyring {
+		service, account, err := splitKeyring(k.Value)
+		if err != nil {
+			return err
+		}
+		return keystore.KeyringSet(service, account, fmt.Sprintf("avh %s/%s", service, account), password)
+	}
+	return keystore.PassSet(k.Value, password)
+}
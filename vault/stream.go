@@ -0,0 +1,448 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// spoolMemoryLimit is the size of ciphertext kept in memory before it is spooled to a temporary file
+	spoolMemoryLimit = 1 << 20
+	wrapWidth        = 80
+)
+
+// ErrWriterClosed is returned when writing to a closed EncryptWriter
+var ErrWriterClosed = errors.New("vault writer closed")
+
+// EncryptOptions are the options of an EncryptWriter
+type EncryptOptions struct {
+	// Label is the vault-id label written in the header
+	Label string
+	// Pad is the number of spaces in front of every line
+	Pad int
+}
+
+// spool holds ciphertext in memory then in a temporary file once it is too large,
+// only ciphertext is ever written to disk
+type spool struct {
+	buffer bytes.Buffer
+	file   *os.File
+	size   int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	s.size += int64(len(p))
+	if s.file == nil && s.buffer.Len()+len(p) > spoolMemoryLimit {
+		file, err := ioutil.TempFile("", "avh-*.cipher")
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+		if _, err = s.buffer.WriteTo(file); err != nil {
+			return 0, err
+		}
+	}
+	if s.file != nil {
+		return s.file.Write(p)
+	}
+	return s.buffer.Write(p)
+}
+
+// reader returns a reader of the whole spooled content
+func (s *spool) reader() (io.Reader, error) {
+	if s.file == nil {
+		return &s.buffer, nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(s.file), nil
+}
+
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	s.file.Close()
+	s.file = nil
+	return os.Remove(name)
+}
+
+// wrapWriter inserts a newline followed by pad every wrapWidth bytes, as wrapText does
+type wrapWriter struct {
+	w      io.Writer
+	sep    []byte
+	column int
+}
+
+func (ww *wrapWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if ww.column == wrapWidth {
+			if _, err := ww.w.Write(ww.sep); err != nil {
+				return written, err
+			}
+			ww.column = 0
+		}
+		n := wrapWidth - ww.column
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := ww.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		ww.column += n
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// EncryptWriter encrypts what is written into a vault written to the underlying writer on Close.
+// The ciphertext is spooled until Close since the vault holds its digest before it.
+type EncryptWriter struct {
+	w        io.Writer
+	password string
+	header   *Header
+	pad      int
+	salt     []byte
+	key      *key
+	stream   cipher.Stream
+	mac      hash.Hash
+	spool    *spool
+	size     int64
+	closed   bool
+}
+
+// NewEncryptWriter returns a writer encrypting into w with the password
+// nothing is written to w before Close
+func NewEncryptWriter(w io.Writer, password string, opts EncryptOptions) (*EncryptWriter, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	if strings.ContainsAny(opts.Label, headerSep+"\r\n") {
+		return nil, ErrInvalidLabel
+	}
+
+	salt, err := generateRandomBytes(saltLength)
+	if err != nil {
+		return nil, err
+	}
+	key := generateKey([]byte(password), salt)
+
+	aesCipher, err := aes.NewCipher(key.cipherKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptWriter{
+		w:        w,
+		password: password,
+		header:   NewHeader(opts.Label),
+		pad:      opts.Pad,
+		salt:     salt,
+		key:      key,
+		stream:   cipher.NewCTR(aesCipher, key.iv),
+		mac:      hmac.New(sha256.New, key.hmacKey),
+		spool:    &spool{},
+	}, nil
+}
+
+func (e *EncryptWriter) encrypt(p []byte) error {
+	data := make([]byte, len(p))
+	e.stream.XORKeyStream(data, p)
+	e.mac.Write(data)
+	_, err := e.spool.Write(data)
+	return err
+}
+
+// Write encrypts p
+func (e *EncryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, ErrWriterClosed
+	}
+	if err := e.encrypt(p); err != nil {
+		return 0, err
+	}
+	e.size += int64(len(p))
+	return len(p), nil
+}
+
+// Close pads the plaintext and writes the vault to the underlying writer
+func (e *EncryptWriter) Close() error {
+	if e.closed {
+		return ErrWriterClosed
+	}
+	e.closed = true
+	defer e.spool.Close()
+
+	padlen := aes.BlockSize - int(e.size%aes.BlockSize)
+	if err := e.encrypt(bytes.Repeat([]byte{byte(padlen)}, padlen)); err != nil {
+		return err
+	}
+
+	sep := strings.Repeat(" ", e.pad)
+	if _, err := io.WriteString(e.w, sep+e.header.String()+"\n"+sep); err != nil {
+		return err
+	}
+
+	payload := hex.NewEncoder(&wrapWriter{w: e.w, sep: []byte("\n" + sep)})
+	prefix := hex.EncodeToString(e.salt) + "\n" + hex.EncodeToString(e.mac.Sum(nil)) + "\n"
+	if _, err := io.WriteString(payload, prefix); err != nil {
+		return err
+	}
+
+	data, err := e.spool.reader()
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(hex.NewEncoder(payload), data); err != nil {
+		return err
+	}
+	keyUsed(e.password)
+	return nil
+}
+
+// spaceSkipper drops the whitespace of the wrapped hex text
+type spaceSkipper struct {
+	r io.Reader
+}
+
+func (s spaceSkipper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, c := range p[:n] {
+			switch c {
+			case ' ', '\t', '\r', '\n':
+			default:
+				p[kept] = c
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// DecryptReader reads the plaintext of a vault
+type DecryptReader struct {
+	identity Identity
+	data     io.Reader
+	spool    *spool
+	stream   cipher.Stream
+	// last block is held back until the end to remove the padding
+	pending       []byte
+	buffer        []byte
+	authenticated bool
+	mac           hash.Hash
+	digest        []byte
+	err           error
+}
+
+// NewDecryptReader returns a reader of the plaintext of the vault read from r.
+// The whole ciphertext is read and its digest checked against every identity before anything can be read,
+// ciphertext larger than 1MiB is spooled to a temporary file meanwhile.
+func NewDecryptReader(r io.Reader, keys Identities) (*DecryptReader, error) {
+	return newDecryptReader(r, keys, true)
+}
+
+// NewUnauthenticatedDecryptReader returns a reader of the plaintext of the vault read from r
+// without spooling the ciphertext. The digest is only checked at the end of the stream,
+// plaintext is released before it is authenticated and only the first identity is used.
+func NewUnauthenticatedDecryptReader(r io.Reader, keys Identities) (*DecryptReader, error) {
+	return newDecryptReader(r, keys, false)
+}
+
+// readPayloadLine reads a hex encoded line of the payload
+func readPayloadLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, ErrInvalidFormat
+	}
+	decoded, err := hex.DecodeString(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		return nil, ErrInvalidFormat
+	}
+	return decoded, nil
+}
+
+func newDecryptReader(r io.Reader, keys Identities, authenticated bool) (*DecryptReader, error) {
+	input := bufio.NewReader(r)
+
+	line, err := input.ReadString('\n')
+	if err != nil {
+		return nil, ErrInvalidFormat
+	}
+	header, err := parseHeaderLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := bufio.NewReader(hex.NewDecoder(spaceSkipper{input}))
+	salt, err := readPayloadLine(payload)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := readPayloadLine(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) == 0 || len(digest) != sha256.Size {
+		return nil, ErrInvalidFormat
+	}
+	data := hex.NewDecoder(payload)
+
+	candidates := Identities{}
+	for _, id := range keys.candidates(header.Label) {
+		if id.Password != "" {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoIdentity
+	}
+
+	d := &DecryptReader{authenticated: authenticated, digest: digest}
+
+	if !authenticated {
+		key := generateKey([]byte(candidates[0].Password), salt)
+		d.identity = Identity{Label: header.Label, Password: candidates[0].Password}
+		d.mac = hmac.New(sha256.New, key.hmacKey)
+		d.data = io.TeeReader(data, d.mac)
+		return d, d.init(key)
+	}
+
+	// alternates of the keys are checked after every key
+	primary := len(candidates)
+	candidates = append(candidates, keys.candidates(header.Label).alternates()...)
+
+	derived := make([]*key, len(candidates))
+	macs := make([]hash.Hash, len(candidates))
+	writers := []io.Writer{}
+	for i, id := range candidates {
+		derived[i] = generateKey([]byte(id.Password), salt)
+		macs[i] = hmac.New(sha256.New, derived[i].hmacKey)
+		writers = append(writers, macs[i])
+	}
+
+	d.spool = &spool{}
+	writers = append(writers, d.spool)
+	if _, err = io.Copy(io.MultiWriter(writers...), data); err != nil {
+		d.spool.Close()
+		return nil, err
+	}
+
+	for i, mac := range macs {
+		if hmac.Equal(mac.Sum(nil), digest) {
+			if i >= primary {
+				warnAlternate(Identity{Label: candidates[i].Label, Password: candidates[i].Alternate, Alternate: candidates[i].Password})
+			}
+			d.identity = Identity{Label: header.Label, Password: candidates[i].Password}
+			keyUsed(d.identity.Password)
+			if d.data, err = d.spool.reader(); err != nil {
+				d.spool.Close()
+				return nil, err
+			}
+			return d, d.init(derived[i])
+		}
+	}
+
+	d.spool.Close()
+	return nil, ErrInvalidPassword
+}
+
+func (d *DecryptReader) init(key *key) error {
+	aesCipher, err := aes.NewCipher(key.cipherKey)
+	if err != nil {
+		d.Close()
+		return err
+	}
+	d.stream = cipher.NewCTR(aesCipher, key.iv)
+	return nil
+}
+
+// Identity returns the header label with the password that opened the vault
+func (d *DecryptReader) Identity() Identity {
+	return d.identity
+}
+
+// Read reads plaintext
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	for len(d.buffer) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+	n := copy(p, d.buffer)
+	d.buffer = d.buffer[n:]
+	return n, nil
+}
+
+// fill decrypts the next chunk, the last block is held back and unpadded at the end
+func (d *DecryptReader) fill() {
+	chunk := make([]byte, 32*1024)
+	n, err := io.ReadFull(d.data, chunk)
+	chunk = chunk[:n]
+
+	plain := make([]byte, len(chunk))
+	d.stream.XORKeyStream(plain, chunk)
+	d.pending = append(d.pending, plain...)
+
+	if err == nil {
+		keep := len(d.pending) - aes.BlockSize
+		d.buffer = append([]byte{}, d.pending[:keep]...)
+		d.pending = append([]byte{}, d.pending[keep:]...)
+		return
+	}
+
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		d.err = err
+		return
+	}
+
+	if !d.authenticated && !hmac.Equal(d.mac.Sum(nil), d.digest) {
+		d.err = ErrInvalidPassword
+		return
+	}
+
+	if len(d.pending) == 0 {
+		d.err = ErrEmptyCiphertext
+		return
+	}
+
+	result, err := unpad(d.pending)
+	if err != nil {
+		d.err = err
+		return
+	}
+	if !d.authenticated {
+		keyUsed(d.identity.Password)
+	}
+	d.buffer = result
+	d.pending = nil
+	d.err = io.EOF
+}
+
+// Close releases the spooled ciphertext
+func (d *DecryptReader) Close() error {
+	if d.spool == nil {
+		return nil
+	}
+	return d.spool.Close()
+}
@@ -0,0 +1,178 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// streamSizes cover empty input, block boundaries, the read chunk and the memory limit of the spool
+var streamSizes = []int{0, 1, 15, 16, 17, 79, 80, 1000, 32*1024 + 3, spoolMemoryLimit + 17}
+
+func testPlaintext(size int) []byte {
+	plaintext := make([]byte, size)
+	for i := range plaintext {
+		plaintext[i] = byte(i*7 + i/256)
+	}
+	return plaintext
+}
+
+// the writer output must be the vault EncryptBytes writes for the same salt
+func TestEncryptWriterMatchesEncryptBytes(t *testing.T) {
+	options := []EncryptOptions{{}, {Label: "prod"}, {Pad: 4}, {Label: "dev", Pad: 2}}
+
+	for _, opts := range options {
+		for _, size := range streamSizes {
+			plaintext := testPlaintext(size)
+
+			var out bytes.Buffer
+			w, err := NewEncryptWriter(&out, "pw", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// uneven writes
+			for rest := plaintext; len(rest) > 0; {
+				n := len(rest)
+				if n > 4099 {
+					n = 4099
+				}
+				if _, err = w.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := encrypt(plaintext, w.salt, w.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := encodeSecret(NewHeader(opts.Label), &secret{data: data, salt: w.salt}, w.key, opts.Pad)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out.String() != want {
+				t.Errorf("%+v size %d : writer output differs from EncryptBytes", opts, size)
+			}
+		}
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	keys := Identities{{Label: DefaultLabel, Password: "pw"}}
+
+	for _, size := range streamSizes {
+		plaintext := testPlaintext(size)
+
+		encrypted, err := EncryptBytes(plaintext, "pw", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, authenticated := range []bool{true, false} {
+			var r *DecryptReader
+			if authenticated {
+				r, err = NewDecryptReader(bytes.NewReader(encrypted), keys)
+			} else {
+				r, err = NewUnauthenticatedDecryptReader(bytes.NewReader(encrypted), keys)
+			}
+			if err != nil {
+				t.Fatalf("size %d : %v", size, err)
+			}
+			got, err := ioutil.ReadAll(iotest.OneByteReader(r))
+			r.Close()
+			if err != nil {
+				t.Fatalf("size %d authenticated %v : %v", size, authenticated, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("size %d authenticated %v : plaintext differs", size, authenticated)
+			}
+		}
+
+		var out bytes.Buffer
+		w, err := NewEncryptWriter(&out, "pw", EncryptOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := DecryptBytes(out.Bytes(), "pw")
+		if err != nil {
+			t.Fatalf("size %d : %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d : DecryptBytes of the writer output differs", size)
+		}
+	}
+}
+
+func TestDecryptReaderIdentity(t *testing.T) {
+	encrypted, err := EncryptBytes([]byte("secret"), "prodpw", "prod", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := Identities{{Label: "dev", Password: "devpw"}, {Label: "prod", Password: "prodpw"}}
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if id := r.Identity(); id.Label != "prod" || id.Password != "prodpw" {
+		t.Errorf("got identity %+v", id)
+	}
+}
+
+func TestDecryptReaderWrongPassword(t *testing.T) {
+	encrypted, err := EncryptBytes(testPlaintext(100), "pw", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := Identities{{Label: DefaultLabel, Password: "wrong"}}
+
+	if _, err = NewDecryptReader(bytes.NewReader(encrypted), keys); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("authenticated : got %v, want %v", err, ErrInvalidPassword)
+	}
+
+	r, err := NewUnauthenticatedDecryptReader(bytes.NewReader(encrypted), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("unauthenticated : got %v, want %v", err, ErrInvalidPassword)
+	}
+}
+
+func TestEncryptWriterClosed(t *testing.T) {
+	w, err := NewEncryptWriter(ioutil.Discard, "pw", EncryptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("x")); err != ErrWriterClosed {
+		t.Errorf("write : got %v, want %v", err, ErrWriterClosed)
+	}
+	if err = w.Close(); err != ErrWriterClosed {
+		t.Errorf("close : got %v, want %v", err, ErrWriterClosed)
+	}
+
+	if _, err = NewEncryptWriter(ioutil.Discard, "", EncryptOptions{}); err != ErrEmptyPassword {
+		t.Errorf("empty password : got %v, want %v", err, ErrEmptyPassword)
+	}
+	if _, err = NewEncryptWriter(ioutil.Discard, "pw", EncryptOptions{Label: "a;b"}); err != ErrInvalidLabel {
+		t.Errorf("invalid label : got %v, want %v", err, ErrInvalidLabel)
+	}
+}
@@ -1,16 +1,15 @@
 package vault
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -20,6 +19,9 @@ const (
 	envKeyExec      = "_VAULT_PASSWORD_EXEC"
 	envKeyFile      = "_VAULT_PASSWORD_FILE"
 	envKey          = "_VAULT_PASSWORD"
+
+	clientScriptSuffix   = "-client"
+	clientScriptNotFound = 2
 )
 
 var (
@@ -29,30 +31,71 @@ var (
 	// ErrInvalidFormat is returned when secret content is not valid
 	ErrInvalidFormat = errors.New("invalid secret format")
 
-	// ErrInvalidPadding is returned when invalid key is used
+	// ErrInvalidPassword is returned when the digest of the secret doesn't match the key
+	ErrInvalidPassword = errors.New("invalid password")
+
+	// ErrInvalidPadding is returned when the decrypted data doesn't end with a valid PKCS#7 padding
 	ErrInvalidPadding = errors.New("invalid padding")
 
+	// ErrEmptyCiphertext is returned when the secret holds no encrypted data
+	ErrEmptyCiphertext = errors.New("empty ciphertext")
+
+	// ErrUnsupportedVersion is returned when the vault format version is not 1.1 or 1.2
+	ErrUnsupportedVersion = errors.New("unsupported vault format version")
+
+	// ErrUnsupportedCipher is returned when the vault cipher is not AES256
+	ErrUnsupportedCipher = errors.New("unsupported vault cipher")
+
+	// ErrInvalidLabel is returned when a vault-id label can't be written in a header
+	ErrInvalidLabel = errors.New("invalid vault-id label")
+
 	ErrKeyFileNotExec = errors.New("key file is not executable")
 
 	ErrKeyFileNotFound = errors.New("key file not found")
+
+	// ErrKeyExecFailed is returned when a key executable exits with an error
+	ErrKeyExecFailed = errors.New("key executable failed")
+
+	// RawKeys disables the normalization of key files and executable output
+	RawKeys bool
+
+	// Warn receives warnings, as a vault only decrypted by the alternate of a key, nothing is reported if nil
+	Warn func(message string)
 )
 
 // Encrypt encrypts the input string with the vault password
 func Encrypt(input string, password string, pad int) (string, error) {
+	return EncryptWithLabel(input, password, "", pad)
+}
+
+// EncryptWithLabel encrypts the input string with the vault password
+// the result has a 1.2 header carrying the vault-id label unless label is empty or default
+func EncryptWithLabel(input string, password string, label string, pad int) (string, error) {
+	result, err := EncryptBytes([]byte(input), password, label, pad)
+	return string(result), err
+}
+
+// EncryptBytes encrypts binary data with the vault password
+// the result has a 1.2 header carrying the vault-id label unless label is empty or default
+func EncryptBytes(input []byte, password string, label string, pad int) ([]byte, error) {
 	if password == "" {
-		return "", ErrEmptyPassword
+		return nil, ErrEmptyPassword
+	}
+
+	if strings.ContainsAny(label, headerSep+"\r\n") {
+		return nil, ErrInvalidLabel
 	}
 
 	salt, err := generateRandomBytes(saltLength)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	key := generateKey([]byte(password), salt)
 
 	// Encrypt the secret content
-	data, err := encrypt([]byte(input), salt, key)
+	data, err := encrypt(input, salt, key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Hash the secret content
@@ -61,7 +104,11 @@ func Encrypt(input string, password string, pad int) (string, error) {
 	hashSum := hash.Sum(nil)
 
 	// Encode the secret payload
-	return encodeSecret(&secret{data: data, salt: salt, hmac: hashSum}, key, pad)
+	result, err := encodeSecret(NewHeader(label), &secret{data: data, salt: salt, hmac: hashSum}, key, pad)
+	if err == nil {
+		keyUsed(password)
+	}
+	return []byte(result), err
 }
 
 // EncryptFile encrypts the input string and saves it into the file
@@ -74,59 +121,60 @@ func EncryptFile(path string, input string, password string) error {
 }
 
 // Return true if the input maybe encrypted as an ansible vault
+// only the $ANSIBLE_VAULT; prefix is checked as ansible does, so an unsupported version or cipher is reported by decrypt
 func MaybeEncrypted(input string) bool {
-	scanner := bufio.NewScanner(strings.NewReader(input))
-
-	if !scanner.Scan() {
-		return false
-	}
-
-	if strings.TrimSpace(scanner.Text()) != vaultHeader {
-		return false
-	}
+	return strings.HasPrefix(strings.TrimLeft(input, " \t"), vaultFormatID+headerSep)
+}
 
-	return true
+// MaybeEncryptedBytes returns true if the binary input maybe encrypted as an ansible vault
+func MaybeEncryptedBytes(input []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(input, " \t"), []byte(vaultFormatID+headerSep))
 }
 
 // Decrypt decrypts the input string with the vault password
 func Decrypt(input string, password string) (string, error) {
+	result, err := DecryptBytes([]byte(input), password)
+	return string(result), err
+}
+
+// DecryptBytes decrypts a vault into binary data with the vault password
+func DecryptBytes(input []byte, password string) ([]byte, error) {
 	if password == "" {
-		return "", ErrEmptyPassword
+		return nil, ErrEmptyPassword
 	}
 
-	lines := strings.Split(input, "\n")
+	idx := bytes.IndexByte(input, '\n')
 
 	// Valid secret must include header and body
-	if len(lines) < 2 {
-		return "", ErrInvalidFormat
+	if idx < 0 {
+		return nil, ErrInvalidFormat
 	}
 
 	// Validate the vault file format
-	if strings.TrimSpace(lines[0]) != vaultHeader {
-		return "", ErrInvalidFormat
+	if _, err := parseHeaderBytes(input); err != nil {
+		return nil, err
 	}
 
-	decoded, err := hex.DecodeString(strings.Join(lines[1:], ""))
+	decoded, err := hexDecode(input[idx+1:])
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	secret, err := decodeSecret(string(decoded))
+	secret, err := decodeSecret(decoded)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	key := generateKey([]byte(password), secret.salt)
 	if err := checkDigest(secret, key); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	result, err := decrypt(secret, key)
-	if err != nil {
-		return "", err
+	if err == nil {
+		keyUsed(password)
 	}
-
-	return result, nil
+	return result, err
 }
 
 // DecryptFile decrypts the content of the file with the vault password
@@ -140,7 +188,79 @@ func DecryptFile(path string, password string) (string, error) {
 
 // obtain a key from a file, if run is true the file will be executed
 func GetKeyFromFile(fileName string, run bool) (string, error) {
+	return GetKeyFromFileWithLabel(fileName, run, "")
+}
+
+// IsClientScript returns true for ansible vault client scripts, named *-client with an optional extension
+func IsClientScript(fileName string) bool {
+	name := filepath.Base(fileName)
+	return strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), clientScriptSuffix)
+}
+
+// GetKeyFromFileWithLabel obtains the key of a vault-id label from a file, if run is true the file will be executed
+// client scripts are given --vault-id label, the default one if label is empty
+// the key is normalized as ansible does unless RawKeys is set
+func GetKeyFromFileWithLabel(fileName string, run bool, label string) (string, error) {
+	key, _, err := getKeyFromFile(fileName, run, label)
+	return key, err
+}
+
+// GetRawKeyFromFileWithLabel obtains the key of a vault-id label from a file as GetKeyFromFileWithLabel does,
+// without normalization, as the agent holds it
+func GetRawKeyFromFileWithLabel(fileName string, run bool, label string) (string, error) {
+	raw, err := readKeyFile(fileName, run, label)
+	if err != nil {
+		return raw, err
+	}
+	if _, _, err = splitKey(fileName, raw, run); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// normalizeKey removes newlines around the output of an executable and whitespace around the content of a file
+// as ansible does
+func normalizeKey(key string, run bool) string {
+	if run {
+		return strings.Trim(key, "\r\n")
+	}
+	return strings.Trim(key, " \t\r\n\v\f")
+}
+
+// getKeyFromFile returns the key of the file and its alternate, the key before normalization,
+// or normalized with RawKeys, if it differs
+func getKeyFromFile(fileName string, run bool, label string) (string, string, error) {
+	raw, err := readKeyFile(fileName, run, label)
+	if err != nil {
+		return raw, "", err
+	}
+	return splitKey(fileName, raw, run)
+}
+
+// splitKey returns the key and its alternate from the content of a key file or the output of an executable
+func splitKey(fileName string, raw string, run bool) (string, string, error) {
+	// as ansible, a key file or an executable output holding only whitespace is an invalid key
+	key := normalizeKey(raw, run)
+	if key == "" {
+		return fileName, "", fmt.Errorf("%s : %w", fileName, ErrEmptyPassword)
+	}
+
+	if RawKeys {
+		key, raw = raw, key
+	}
+	if raw == key {
+		raw = ""
+	}
+
+	return key, raw, nil
+}
+
+// readKeyFile returns the content of a key file or the output of an executable as is
+func readKeyFile(fileName string, run bool, label string) (string, error) {
 	stat, err := os.Stat(fileName)
+	if os.IsNotExist(err) {
+		return fileName, fmt.Errorf("%s : %w", fileName, ErrKeyFileNotFound)
+	}
 	if err != nil {
 		return fileName, err
 	}
@@ -149,34 +269,88 @@ func GetKeyFromFile(fileName string, run bool) (string, error) {
 		if (stat.Mode() & execModeAll) == 0 {
 			return fileName, ErrKeyFileNotExec
 		}
+		// a relative path must not be looked up in PATH
+		execPath, err := filepath.Abs(fileName)
+		if err != nil {
+			return fileName, err
+		}
+
+		if label == "" {
+			label = DefaultLabel
+		}
+		args := []string{}
+		if IsClientScript(fileName) {
+			args = append(args, "--vault-id", label)
+		}
+
 		var stdout bytes.Buffer
-		cmd := exec.Command(fileName)
+		cmd := exec.Command(execPath, args...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = &stdout
 		cmd.Stderr = os.Stderr
 		if err = cmd.Run(); err != nil {
-			return fileName, err
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fileName, err
+			}
+			// as ansible, a client script exits with 2 when it has no key for the vault-id
+			if len(args) > 0 && exitErr.ExitCode() == clientScriptNotFound {
+				return fileName, fmt.Errorf("%s has no key for vault-id %s : %w", fileName, label, ErrUnknownVaultID)
+			}
+			return fileName, fmt.Errorf("%s exited with %d : %w", fileName, exitErr.ExitCode(), ErrKeyExecFailed)
 		}
-		return string(stdout.Bytes()), nil
+
+		return stdout.String(), nil
 	}
 
 	key, err := ioutil.ReadFile(fileName)
+	if err == nil && IsWrappedKey(key) {
+		if key, err = unwrapKey(key); err != nil {
+			return fileName, fmt.Errorf("%s : %w", fileName, err)
+		}
+	}
 	return string(key), err
 }
 
 // get key from specified key or from env var if not specified
 func GetKey(keyChoice Key, envPrefix string) (string, error) {
+	key, _, err := GetKeyWithAlternate(keyChoice, envPrefix)
+	return key, err
+}
+
+// GetKeyWithAlternate gets the key as GetKey does with its alternate, the content of a key file or the output of
+// an executable before normalization, or normalized with RawKeys, when it differs from the key
+func GetKeyWithAlternate(keyChoice Key, envPrefix string) (string, string, error) {
 	key := keyChoice.Value
 	isExec := keyChoice.IsExec
 	isFile := keyChoice.IsFile
 
 	label := ""
 
+	if keyChoice.IsPrompt {
+		// a prompted key may have been added to the agent
+		key, _ = agentKey(keyChoice)
+		return key, "", nil
+	}
+
+	if keyChoice.IsKeyring || keyChoice.IsPass {
+		if cached, ok := agentKey(keyChoice); ok {
+			return cached, "", nil
+		}
+		key, err := getStoreKey(keyChoice)
+		if err != nil {
+			return "", "", fmt.Errorf("from --vault-id %s : %w", keyChoice.AgentID(), err)
+		}
+		return key, "", nil
+	}
+
 	if key != "" {
 		if !isFile {
-			return key, nil
+			return key, "", nil
 		}
 		switch {
+		case keyChoice.Label != "":
+			label = "from --vault-id " + keyChoice.Label
 		case isExec:
 			label = "from --key-exec"
 		case isFile:
@@ -208,14 +382,41 @@ func GetKey(keyChoice Key, envPrefix string) (string, error) {
 		}
 	}
 
-	var err error
+	if !isFile {
+		return key, "", nil
+	}
 
-	if isFile {
-		key, err = GetKeyFromFile(key, isExec)
-		if err != nil {
-			return key, fmt.Errorf("%s : %w", label, err)
+	source := Key{Label: keyChoice.Label, Value: key, IsFile: true, IsExec: isExec}
+	// the agent spares reading the file or running the executable, it holds the key as read,
+	// so it's normalized as the one of the file
+	raw, cached := agentKey(source)
+	if !cached {
+		var err error
+		if raw, err = readKeyFile(key, isExec, keyChoice.Label); err != nil {
+			return raw, "", fmt.Errorf("%s : %w", label, err)
 		}
 	}
 
-	return key, err
+	key, alternate, err := splitKey(source.Value, raw, isExec)
+	if err != nil {
+		return key, "", fmt.Errorf("%s : %w", label, err)
+	}
+
+	// executables may be slow and wrapped key files may ask for a passphrase, their key is kept by the agent
+	// once it opened or sealed a vault
+	if !cached && (isExec || isWrappedKeyFile(source.Value)) {
+		cacheKey(source, raw, key, alternate)
+	}
+
+	return key, alternate, nil
+}
+
+// HasEnvKey returns true if a key is given by the env variables of the prefix
+func HasEnvKey(envPrefix string) bool {
+	for _, name := range []string{envKeyExec, envKeyFile, envKey} {
+		if os.Getenv(envPrefix+name) != "" {
+			return true
+		}
+	}
+	return false
 }
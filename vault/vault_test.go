@@ -0,0 +1,204 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPassword = "pw"
+
+// testVault encrypts the plaintext with testPassword
+func testVault(t testing.TB, plaintext string, label string) string {
+	result, err := EncryptWithLabel(plaintext, testPassword, label, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// badPaddingVault returns a vault with a valid digest whose plaintext has no valid padding
+func badPaddingVault(t testing.TB) string {
+	salt := bytes.Repeat([]byte{1}, saltLength)
+	key := generateKey([]byte(testPassword), salt)
+
+	data, err := encrypt([]byte("0123456789abcde"), salt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the plaintext block ends with 0 instead of the padding
+	data = data[:16]
+	data[15] ^= 1
+
+	mac := hmac.New(sha256.New, key.hmacKey)
+	mac.Write(data)
+
+	result, err := encodeSecret(NewHeader(""), &secret{data: data, salt: salt, hmac: mac.Sum(nil)}, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// decryptSeeds are valid vaults and broken ones with the error expected
+func decryptSeeds(t testing.TB) []struct {
+	input string
+	err   error
+} {
+	v11 := testVault(t, "secret\n", "")
+	v12 := testVault(t, "secret", "prod")
+	lines := strings.Split(v11, "\n")
+
+	return []struct {
+		input string
+		err   error
+	}{
+		{input: v11},
+		{input: v12},
+		{input: testVault(t, "", "")},
+		{input: testVault(t, strings.Repeat("x", 100), "dev")},
+		{input: "  " + strings.Replace(v11, "\n", "\n  ", -1) + "\n"},
+		{input: v11[:len(lines[0])], err: ErrInvalidFormat},
+		{input: v11[:len(lines[0])+1], err: ErrInvalidFormat},
+		{input: v11[:len(v11)-1], err: ErrInvalidFormat},
+		{input: v11[:len(v11)-4], err: ErrInvalidPassword},
+		{input: strings.Join(lines[:len(lines)-1], "\n"), err: ErrInvalidPassword},
+		{input: strings.Replace(v11, "AES256", "AES128", 1), err: ErrUnsupportedCipher},
+		{input: strings.Replace(v11, "1.1", "1.3", 1), err: ErrUnsupportedVersion},
+		{input: strings.Replace(v11, lines[1], lines[1][:79]+"z", 1), err: ErrInvalidFormat},
+		{input: lines[0] + "\n6162\n", err: ErrInvalidFormat},
+		{input: lines[0] + "\n" + hex.EncodeToString([]byte("00\n"+strings.Repeat("00", 32)+"\n")), err: ErrEmptyCiphertext},
+		{input: badPaddingVault(t), err: ErrInvalidPadding},
+		{input: "", err: ErrInvalidFormat},
+		{input: "$ANSIBLE_VAULT;1.1;AES256", err: ErrInvalidFormat},
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	for i, seed := range decryptSeeds(t) {
+		_, err := DecryptBytes([]byte(seed.input), testPassword)
+		if !errors.Is(err, seed.err) {
+			t.Errorf("seed %d : got error %v, want %v", i, err, seed.err)
+		}
+	}
+
+	if _, err := Decrypt(testVault(t, "x", ""), "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("wrong password : got %v, want %v", err, ErrInvalidPassword)
+	}
+	if _, err := Decrypt(testVault(t, "x", ""), ""); !errors.Is(err, ErrEmptyPassword) {
+		t.Errorf("empty password : got %v, want %v", err, ErrEmptyPassword)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, plaintext := range []string{"", "x", "secret\n", strings.Repeat("0123456789abcdef", 4), "\x00\xff binary"} {
+		for _, pad := range []int{0, 2, 6} {
+			encrypted, err := EncryptBytes([]byte(plaintext), testPassword, "dev", pad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !MaybeEncryptedBytes(encrypted) {
+				t.Errorf("%q : not detected as a vault", plaintext)
+			}
+			for _, line := range strings.Split(string(encrypted), "\n") {
+				if len(line) > 80+pad || !strings.HasPrefix(line, strings.Repeat(" ", pad)) {
+					t.Errorf("%q pad %d : badly wrapped line %q", plaintext, pad, line)
+				}
+			}
+			got, err := DecryptBytes(encrypted, testPassword)
+			if err != nil || string(got) != plaintext {
+				t.Errorf("%q pad %d : got %q, %v", plaintext, pad, got, err)
+			}
+		}
+	}
+}
+
+func TestGetKeyFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avh-key-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(raw bool) { RawKeys = raw }(RawKeys)
+
+	tests := []struct {
+		name      string
+		content   string
+		run       bool
+		raw       bool
+		key       string
+		alternate string
+		err       error
+	}{
+		{name: "file", content: "pw", key: "pw"},
+		{name: "file with newline", content: "pw\n", key: "pw", alternate: "pw\n"},
+		{name: "file with spaces", content: " pw \t\n", key: "pw", alternate: " pw \t\n"},
+		{name: "raw file", content: "pw\n", raw: true, key: "pw\n", alternate: "pw"},
+		{name: "empty file", content: "", err: ErrEmptyPassword},
+		{name: "whitespace file", content: " \t\r\n", err: ErrEmptyPassword},
+		{name: "raw whitespace file", content: " \n", raw: true, err: ErrEmptyPassword},
+		{name: "executable", content: "#!/bin/sh\necho ' pw '\n", run: true, key: " pw ", alternate: " pw \n"},
+		{name: "empty executable", content: "#!/bin/sh\necho\n", run: true, err: ErrEmptyPassword},
+	}
+
+	for i, tt := range tests {
+		fileName := filepath.Join(dir, fmt.Sprintf("key%d", i))
+		if err = ioutil.WriteFile(fileName, []byte(tt.content), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		RawKeys = tt.raw
+		key, alternate, err := getKeyFromFile(fileName, tt.run, "")
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s : got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && (key != tt.key || alternate != tt.alternate) {
+			t.Errorf("%s : got %q, %q, want %q, %q", tt.name, key, alternate, tt.key, tt.alternate)
+		}
+	}
+}
+
+func FuzzDecrypt(f *testing.F) {
+	for _, seed := range decryptSeeds(f) {
+		f.Add([]byte(seed.input))
+	}
+
+	known := []error{
+		ErrInvalidFormat, ErrInvalidPassword, ErrInvalidPadding, ErrEmptyCiphertext,
+		ErrUnsupportedVersion, ErrUnsupportedCipher,
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		result, err := DecryptBytes(input, testPassword)
+		if err != nil {
+			for _, e := range known {
+				if errors.Is(err, e) {
+					return
+				}
+			}
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if !MaybeEncryptedBytes(input) {
+			t.Fatalf("%q decrypted but isn't detected as a vault", input)
+		}
+
+		encrypted, err := EncryptBytes(result, testPassword, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := DecryptBytes(encrypted, testPassword)
+		if err != nil || !bytes.Equal(again, result) {
+			t.Fatalf("round trip : got %q, %v, want %q", again, err, result)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// headers of key files wrapped with age or OpenPGP
+const (
+	ageHeader      = "age-encryption.org/v1\n"
+	ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	pgpArmorHeader = "-----BEGIN PGP MESSAGE-----"
+)
+
+var (
+	// KeyIdentities are the age identity files and ssh private keys tried to unwrap age key files,
+	// ~/.ssh/id_ed25519 and ~/.ssh/id_rsa when empty, OpenPGP key files are decrypted by gpg with the keys of the user
+	KeyIdentities []string
+
+	// ErrUnwrapKey is returned when a wrapped key file can't be decrypted
+	ErrUnwrapKey = errors.New("can't decrypt wrapped key file")
+
+	// ErrMixedRecipients is returned when a key is wrapped for age and OpenPGP recipients at once
+	ErrMixedRecipients = errors.New("recipients must be all age and ssh keys or all OpenPGP keys")
+
+	// ErrNoRecipient is returned when a key is wrapped for no recipient
+	ErrNoRecipient = errors.New("no recipient to wrap the key for")
+
+	defaultSSHKeys = []string{"id_ed25519", "id_rsa"}
+)
+
+// IsWrappedKey returns true if the key file content is encrypted with age or armored OpenPGP
+func IsWrappedKey(content []byte) bool {
+	content = bytes.TrimLeft(content, " \t\r\n")
+	return bytes.HasPrefix(content, []byte(ageHeader)) ||
+		bytes.HasPrefix(content, []byte(ageArmorHeader)) ||
+		bytes.HasPrefix(content, []byte(pgpArmorHeader))
+}
+
+func isWrappedKeyFile(fileName string) bool {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 64)
+	n, _ := file.Read(head)
+	return IsWrappedKey(head[:n])
+}
+
+// keyIdentities returns the identities given or the default ssh keys found
+func keyIdentities() []string {
+	if len(KeyIdentities) > 0 {
+		return KeyIdentities
+	}
+
+	identities := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range defaultSSHKeys {
+			if fileName := filepath.Join(home, ".ssh", name); isRegularFile(fileName) {
+				identities = append(identities, fileName)
+			}
+		}
+	}
+	return identities
+}
+
+func isRegularFile(fileName string) bool {
+	stat, err := os.Stat(fileName)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+// runCrypt runs age or gpg with content on stdin, the terminal stays available for passphrases
+func runCrypt(content []byte, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s : %v : %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// unwrapKey decrypts an age key file with the key identities or an OpenPGP key file with gpg
+func unwrapKey(content []byte) ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), []byte(pgpArmorHeader)) {
+		key, err := runCrypt(content, "gpg", "--quiet", "--batch", "--decrypt")
+		if err != nil {
+			return nil, fmt.Errorf("%v : %w", err, ErrUnwrapKey)
+		}
+		return key, nil
+	}
+
+	identities := keyIdentities()
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identity or ssh key, use --key-identity : %w", ErrUnwrapKey)
+	}
+
+	args := []string{"--decrypt"}
+	for _, identity := range identities {
+		args = append(args, "--identity", identity)
+	}
+
+	key, err := runCrypt(content, "age", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%v : %w", err, ErrUnwrapKey)
+	}
+	return key, nil
+}
+
+// isAgeRecipient returns true for age and ssh public keys and for files holding them
+func isAgeRecipient(recipient string) bool {
+	return strings.HasPrefix(recipient, "age1") || strings.HasPrefix(recipient, "ssh-") || isRegularFile(recipient)
+}
+
+// WrapKey encrypts a key for the recipients, age1 and ssh public keys or files holding them are encrypted with age,
+// other recipients are OpenPGP key ids encrypted with gpg, the result is armored to be committed
+func WrapKey(password string, recipients []string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipient
+	}
+
+	age := 0
+	for _, recipient := range recipients {
+		if isAgeRecipient(recipient) {
+			age++
+		}
+	}
+
+	switch age {
+	case len(recipients):
+		args := []string{"--encrypt", "--armor"}
+		for _, recipient := range recipients {
+			if isRegularFile(recipient) {
+				args = append(args, "--recipients-file", recipient)
+			} else {
+				args = append(args, "--recipient", recipient)
+			}
+		}
+		return runCrypt([]byte(password), "age", args...)
+	case 0:
+		args := []string{"--quiet", "--batch", "--yes", "--encrypt", "--armor"}
+		for _, recipient := range recipients {
+			args = append(args, "--recipient", recipient)
+		}
+		return runCrypt([]byte(password), "gpg", args...)
+	}
+
+	return nil, ErrMixedRecipients
+}
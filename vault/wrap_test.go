@@ -0,0 +1,29 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWrapKeyErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		recipients []string
+		err        error
+	}{
+		{name: "empty password", password: "", recipients: []string{"age1xyz"}, err: ErrEmptyPassword},
+		{name: "no recipient", password: testPassword, recipients: nil, err: ErrNoRecipient},
+		{name: "mixed recipients", password: testPassword, recipients: []string{"age1xyz", "ABCDEF0123456789"}, err: ErrMixedRecipients},
+	}
+
+	for _, tt := range tests {
+		if _, err := WrapKey(tt.password, tt.recipients); !errors.Is(err, tt.err) {
+			t.Errorf("%s : got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	if _, err := WrapKey(testPassword, nil); errors.Is(err, ErrMixedRecipients) {
+		t.Errorf("no recipient : reported as %v", err)
+	}
+}